@@ -0,0 +1,70 @@
+// Package apperr classifies the errors repositories and use cases return, so
+// they can be reported to clients with the right status code.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of error. Match them with errors.Is.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrInvalidArgument    = errors.New("invalid argument")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUnauthenticated    = errors.New("unauthenticated")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrFailedPrecondition = errors.New("failed precondition")
+	ErrRateLimited        = errors.New("rate limited")
+)
+
+// Error is an error of a given kind with a stable, machine-readable reason
+// such as "ACCOUNT_NOT_FOUND". Its message is safe to show to clients.
+type Error struct {
+	kind    error
+	reason  string
+	message string
+	parent  *Error
+}
+
+// New returns an error of kind, e.g. ErrNotFound.
+func New(kind error, reason, message string) *Error {
+	return &Error{kind: kind, reason: reason, message: message}
+}
+
+// Withf returns a copy of e with detail appended to its message. The copy
+// still matches e with errors.Is.
+func (e *Error) Withf(format string, args ...interface{}) *Error {
+	return &Error{
+		kind:    e.kind,
+		reason:  e.reason,
+		message: e.message + ": " + fmt.Sprintf(format, args...),
+		parent:  e,
+	}
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Kind returns the kind e was created with.
+func (e *Error) Kind() error {
+	return e.kind
+}
+
+func (e *Error) Reason() string {
+	return e.reason
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *Error) Unwrap() error {
+	if e.parent == nil {
+		return nil
+	}
+	return e.parent
+}
@@ -2,17 +2,33 @@ package config
 
 import (
 	"errors"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	GRPCPORT    string `mapstructure:"GRPC_PORT"`
-	HTTPPort    string `mapstructure:"HTTP_PORT"`
-	PostgresURL string `mapstructure:"POSTGRES_URL"`
-	RedisURL    string `mapstructure:"REDIS_URL"`
-	RabbitMQURL string `mapstructure:"RABBITMQ_URL"`
-	JWTSecret   string `mapstructure:"JWT_SECRET"`
+	GRPCPORT       string        `mapstructure:"GRPC_PORT"`
+	HTTPPort       string        `mapstructure:"HTTP_PORT"`
+	PostgresURL    string        `mapstructure:"POSTGRES_URL"`
+	RedisURL       string        `mapstructure:"REDIS_URL"`
+	RabbitMQURL    string        `mapstructure:"RABBITMQ_URL"`
+	JWTKeyFiles    string        `mapstructure:"JWT_SIGNING_KEY_FILES"`
+	JWTExpires     time.Duration `mapstructure:"JWT_EXPIRES"`
+	RefreshExpires time.Duration `mapstructure:"REFRESH_TOKEN_EXPIRES"`
+	// VerificationExpires is how long an email verification link works.
+	VerificationExpires time.Duration `mapstructure:"EMAIL_VERIFICATION_EXPIRES"`
+	// PasswordResetExpires is how long a password reset link works.
+	PasswordResetExpires time.Duration `mapstructure:"PASSWORD_RESET_EXPIRES"`
+	// TransactionServiceTarget is the gRPC address of transaction-service,
+	// which closes the wallet of an account being closed.
+	TransactionServiceTarget string `mapstructure:"TRANSACTION_SERVICE_TARGET"`
+	// ShutdownDrainDelay is how long the service reports not-ready before it
+	// stops accepting connections.
+	ShutdownDrainDelay time.Duration `mapstructure:"SHUTDOWN_DRAIN_DELAY"`
+	// TracesExporter is none, otlp or stdout.
+	TracesExporter string `mapstructure:"OTEL_TRACES_EXPORTER"`
+	OTLPEndpoint   string `mapstructure:"OTEL_EXPORTER_OTLP_ENDPOINT"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -2,27 +2,172 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// DefaultCurrency is the ISO 4217 currency of newly created wallets.
+const DefaultCurrency = "IDR"
+
 type Account struct {
 	ID        string    `json:"id"`
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	Balance   float64   `json:"balance"`
+	Password  string    `json:"-"`       // bcrypt hash, kept out of the account cache
+	Balance   int64     `json:"balance"` // minor units of Currency
+	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// EmailVerifiedAt is set once the owner proves they receive mail at Email,
+	// and cleared when Email changes.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// ClosedAt is set once the account is closed.
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
 }
 
 type CustomClaim struct {
 	ID    string `json:"id"`
 	Email string `json:"email"`
+	// SessionID is the refresh token family the access token was issued with.
+	SessionID string `json:"sid,omitempty"`
+	// Scope is only set on the tokens account-service signs for itself to call
+	// other services, e.g. ScopeCloseWallet.
+	Scope string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
-type AccountPublisher interface {
-	PublishAccountCreated(ctx context.Context, id, name, email string) error
+// ScopeCloseWallet lets account-service close wallets in transaction-service.
+const ScopeCloseWallet = "wallets:close"
+
+// TokenPair is what a successful login or refresh hands back to the client.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// RefreshToken is the stored form of an opaque refresh token. Only the hash of
+// the token is kept; all tokens rotated from the same login share a FamilyID.
+type RefreshToken struct {
+	Hash      string    `json:"-"`
+	AccountID string    `json:"account_id"`
+	FamilyID  string    `json:"family_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// EmailVerification is a pending email verification. Only the hash of the
+// token is stored; Token is filled in when the verification is issued so it
+// can be sent to the owner.
+type EmailVerification struct {
+	Token     string
+	TokenHash string
+	AccountID string
+	Email     string
+	ExpiresAt time.Time
+}
+
+// PasswordReset is a pending password reset. As with EmailVerification, only
+// the hash of the token is stored.
+type PasswordReset struct {
+	Token     string
+	TokenHash string
+	AccountID string
+	ExpiresAt time.Time
+}
+
+// Routing keys of the events account-service publishes to emoney_exchange.
+const (
+	RoutingKeyAccountCreated = "account.created"
+	RoutingKeyAccountUpdated = "account.updated"
+	RoutingKeyAccountClosed  = "account.closed"
+	// RoutingKeyVerificationRequested events are meant for a mailer, which sends
+	// the token to the email in the event. They are written to the outbox as a
+	// TokenRequest and the token is issued when they are published.
+	RoutingKeyVerificationRequested = "account.verification_requested"
+	// RoutingKeyPasswordResetRequested events are likewise meant for a mailer,
+	// and written to the outbox as a TokenRequest with only the email.
+	RoutingKeyPasswordResetRequested = "account.password_reset_requested"
+)
+
+type AccountCreatedEvent struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// AccountUpdatedEvent carries the account's current name and email. Consumers
+// ignore events older than the last one they applied, judged by UpdatedAt.
+type AccountUpdatedEvent struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TokenRequest is what the outbox holds for an event that carries a one-time
+// token, in place of the event itself, so that the token is never stored.
+type TokenRequest struct {
+	AccountID string `json:"account_id,omitempty"`
+	Email     string `json:"email"`
+}
+
+type VerificationRequestedEvent struct {
+	AccountID string    `json:"account_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type PasswordResetRequestedEvent struct {
+	AccountID string    `json:"account_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AccountClosedEvent struct {
+	ID       string    `json:"id"`
+	ClosedAt time.Time `json:"closed_at"`
+}
+
+// OutboxEvent is a domain event stored in the same database transaction as the
+// change it describes and published to the broker afterwards.
+type OutboxEvent struct {
+	ID          string
+	AggregateID string
+	RoutingKey  string
+	Payload     []byte
+	Attempts    int
+	CreatedAt   time.Time
+	// TraceContext carries the trace of the request that wrote the event.
+	TraceContext map[string]string
+	// LastError is why the latest attempt to publish the event failed.
+	LastError string
+}
+
+// ErrEventUndeliverable marks a failure to publish an outbox event that no
+// retry can fix, such as a payload that cannot be decoded. The event is
+// dead-lettered at once instead of holding back the events behind it.
+var ErrEventUndeliverable = errors.New("outbox event cannot be delivered")
+
+// TokenSigner signs access tokens with the service's current signing key.
+type TokenSigner interface {
+	Sign(claims jwt.Claims) (string, error)
+}
+
+// WalletService is the part of transaction-service that holds the balance of
+// an account.
+type WalletService interface {
+	// CloseWallet closes the account's wallet, failing unless its balance is
+	// zero. Closing a closed wallet succeeds.
+	CloseWallet(ctx context.Context, accountID string) error
+}
+
+type EventPublisher interface {
+	Publish(ctx context.Context, routingKey, messageID string, body []byte) error
 }
@@ -2,15 +2,24 @@ package handler
 
 import (
 	"context"
+	"net"
+	"strings"
+
 	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/account-service/server/apperr"
 	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
 	"github.com/zuyatna/emoney-microservice/account-service/server/pb"
 	"github.com/zuyatna/emoney-microservice/account-service/server/usecase"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// ErrNotAccountOwner is returned when a caller acts on another user's account.
+var ErrNotAccountOwner = apperr.New(apperr.ErrPermissionDenied, "NOT_ACCOUNT_OWNER", "you can only access your own account")
+
+// AccountHandler returns use case errors as they are; the error interceptor
+// turns them into gRPC statuses.
 type AccountHandler struct {
 	pb.UnimplementedAccountServiceServer
 	usecase usecase.AccountUseCase
@@ -21,11 +30,10 @@ func NewAccountHandler(usecase usecase.AccountUseCase, logger *logrus.Entry) *Ac
 	return &AccountHandler{usecase: usecase, logger: logger}
 }
 
-func (h *AccountHandler) Create(ctx context.Context, req *pb.CreateAccountRequest) (*pb.CreateAccountResponse, error) {
+func (h *AccountHandler) CreateAccount(ctx context.Context, req *pb.CreateAccountRequest) (*pb.CreateAccountResponse, error) {
 	id, err := h.usecase.CreateAccount(ctx, req.GetName(), req.GetEmail(), req.GetPassword())
 	if err != nil {
-		h.logger.WithError(err).Error("Error creating account")
-		return nil, status.Error(codes.Internal, "Error creating account")
+		return nil, err
 	}
 
 	h.logger.WithField("account_id", id).Info("Account created successfully")
@@ -33,34 +41,185 @@ func (h *AccountHandler) Create(ctx context.Context, req *pb.CreateAccountReques
 }
 
 func (h *AccountHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	token, err := h.usecase.LoginAccount(ctx, req.GetEmail(), req.GetPassword())
+	tokens, err := h.usecase.LoginAccount(ctx, req.GetEmail(), req.GetPassword())
 	if err != nil {
-		h.logger.WithError(err).Error("Error logging in")
-		return nil, status.Error(codes.Internal, "Error logging in")
+		return nil, err
+	}
+
+	h.logger.WithField("email", req.GetEmail()).Info("Account logged in")
+	return toLoginResponse(tokens), nil
+}
+
+func (h *AccountHandler) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.LoginResponse, error) {
+	tokens, err := h.usecase.RefreshToken(ctx, req.GetRefreshToken())
+	if err != nil {
+		return nil, err
+	}
+
+	return toLoginResponse(tokens), nil
+}
+
+func (h *AccountHandler) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	if err := h.usecase.Logout(ctx, req.GetRefreshToken()); err != nil {
+		return nil, err
 	}
 
-	h.logger.WithField("token", token).Info("Account logged in")
-	return &pb.LoginResponse{AccessToken: token}, nil
+	return &pb.LogoutResponse{Message: "Logged out successfully"}, nil
+}
+
+func toLoginResponse(tokens *domain.TokenPair) *pb.LoginResponse {
+	return &pb.LoginResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+	}
 }
 
 func (h *AccountHandler) GetAccount(ctx context.Context, req *pb.GetAccountRequest) (*pb.Account, error) {
-	claims, ok := ctx.Value("claims").(*domain.CustomClaim)
-	if !ok || claims.ID != req.GetAccountId() {
-		return nil, status.Error(codes.PermissionDenied, "You can only view your own account")
+	if _, err := ownerClaims(ctx, req.GetAccountId()); err != nil {
+		return nil, err
 	}
 
 	account, err := h.usecase.GetAccountByID(ctx, req.GetAccountId())
 	if err != nil {
-		h.logger.WithError(err).WithField("account_id", req.GetAccountId()).Error("Error getting account")
-		return nil, status.Errorf(codes.NotFound, "Could not find account: %v", err)
+		return nil, err
+	}
+
+	return toPBAccount(account), nil
+}
+
+func (h *AccountHandler) UpdateAccount(ctx context.Context, req *pb.UpdateAccountRequest) (*pb.Account, error) {
+	if _, err := ownerClaims(ctx, req.GetAccountId()); err != nil {
+		return nil, err
+	}
+
+	account, err := h.usecase.UpdateAccount(ctx, req.GetAccountId(), req.Name, req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	h.logger.WithField("account_id", account.ID).Info("Account updated")
+	return toPBAccount(account), nil
+}
+
+func (h *AccountHandler) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	claims, err := ownerClaims(ctx, req.GetAccountId())
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.usecase.ChangePassword(ctx, req.GetAccountId(), claims.SessionID, req.GetCurrentPassword(), req.GetNewPassword())
+	if err != nil {
+		return nil, err
+	}
+
+	h.logger.WithField("account_id", req.GetAccountId()).Info("Password changed")
+	return &pb.ChangePasswordResponse{Message: "Password changed successfully"}, nil
+}
+
+func (h *AccountHandler) CloseAccount(ctx context.Context, req *pb.CloseAccountRequest) (*pb.CloseAccountResponse, error) {
+	if _, err := ownerClaims(ctx, req.GetAccountId()); err != nil {
+		return nil, err
+	}
+
+	if err := h.usecase.CloseAccount(ctx, req.GetAccountId(), req.GetPassword()); err != nil {
+		return nil, err
 	}
 
-	return &pb.Account{
-		Id:        account.ID,
-		Name:      account.Name,
-		Email:     account.Email,
-		Balance:   account.Balance,
+	h.logger.WithField("account_id", req.GetAccountId()).Info("Account closed")
+	return &pb.CloseAccountResponse{Message: "Account closed successfully"}, nil
+}
+
+func (h *AccountHandler) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	if err := h.usecase.VerifyEmail(ctx, req.GetToken()); err != nil {
+		return nil, err
+	}
+
+	return &pb.VerifyEmailResponse{Message: "Email verified successfully"}, nil
+}
+
+func (h *AccountHandler) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
+	if err := h.usecase.RequestPasswordReset(ctx, req.GetEmail(), clientIP(ctx)); err != nil {
+		return nil, err
+	}
+
+	return &pb.RequestPasswordResetResponse{Message: "If an account with this email exists, a password reset email has been sent"}, nil
+}
+
+func (h *AccountHandler) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
+	if err := h.usecase.ResetPassword(ctx, req.GetToken(), req.GetNewPassword()); err != nil {
+		return nil, err
+	}
+
+	return &pb.ResetPasswordResponse{Message: "Password reset successfully"}, nil
+}
+
+// clientIP returns the address of the client that made the request. Calls
+// from the HTTP gateway, which runs in this process and dials the server over
+// loopback, come from the last X-Forwarded-For entry, the one the gateway added
+// itself; earlier entries come from the client and are not trusted. For any
+// other caller X-Forwarded-For is ignored, since it could set it to anything.
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return host
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-forwarded-for"); len(values) > 0 {
+			hops := strings.Split(values[len(values)-1], ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	return host
+}
+
+func (h *AccountHandler) ResendVerification(ctx context.Context, req *pb.ResendVerificationRequest) (*pb.ResendVerificationResponse, error) {
+	if _, err := ownerClaims(ctx, req.GetAccountId()); err != nil {
+		return nil, err
+	}
+
+	if err := h.usecase.ResendVerification(ctx, req.GetAccountId()); err != nil {
+		return nil, err
+	}
+
+	h.logger.WithField("account_id", req.GetAccountId()).Info("Verification email requested")
+	return &pb.ResendVerificationResponse{Message: "Verification email sent"}, nil
+}
+
+// ownerClaims returns the caller's claims if the caller owns accountID.
+func ownerClaims(ctx context.Context, accountID string) (*domain.CustomClaim, error) {
+	claims, ok := ctx.Value("claims").(*domain.CustomClaim)
+	if !ok || claims.ID != accountID {
+		return nil, ErrNotAccountOwner
+	}
+	return claims, nil
+}
+
+func toPBAccount(account *domain.Account) *pb.Account {
+	resp := &pb.Account{
+		Id:    account.ID,
+		Name:  account.Name,
+		Email: account.Email,
+		Balance: &pb.Money{
+			CurrencyCode: account.Currency,
+			MinorUnits:   account.Balance,
+		},
 		CreatedAt: timestamppb.New(account.CreatedAt),
 		UpdatedAt: timestamppb.New(account.UpdatedAt),
-	}, nil
+	}
+	if account.EmailVerifiedAt != nil {
+		resp.EmailVerifiedAt = timestamppb.New(*account.EmailVerifiedAt)
+	}
+	if account.ClosedAt != nil {
+		resp.ClosedAt = timestamppb.New(*account.ClosedAt)
+	}
+	return resp
 }
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name string
+		peer net.Addr
+		// forwardedFor are the x-forwarded-for metadata values, if any.
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:         "gateway over IPv4 loopback",
+			peer:         &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 50000},
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "gateway over IPv6 loopback",
+			peer:         &net.TCPAddr{IP: net.IPv6loopback, Port: 50000},
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "only the hop the gateway added",
+			peer:         &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 50000},
+			forwardedFor: []string{"198.51.100.1, 198.51.100.2, 203.0.113.7"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "only the last value",
+			peer:         &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 50000},
+			forwardedFor: []string{"198.51.100.1", "203.0.113.7"},
+			want:         "203.0.113.7",
+		},
+		{
+			name: "gateway without a forwarded address",
+			peer: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 50000},
+			want: "127.0.0.1",
+		},
+		{
+			name:         "direct client cannot forward",
+			peer:         &net.TCPAddr{IP: net.ParseIP("198.51.100.9"), Port: 50000},
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "198.51.100.9",
+		},
+		{
+			name:         "direct IPv6 client cannot forward",
+			peer:         &net.TCPAddr{IP: net.ParseIP("2001:db8::9"), Port: 50000},
+			forwardedFor: []string{"127.0.0.1"},
+			want:         "2001:db8::9",
+		},
+		{
+			name:         "non-IP peer cannot forward",
+			peer:         &net.UnixAddr{Name: "/tmp/account.sock", Net: "unix"},
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "/tmp/account.sock",
+		},
+		{
+			name:         "no peer",
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.peer != nil {
+				ctx = peer.NewContext(ctx, &peer.Peer{Addr: tt.peer})
+			}
+			if tt.forwardedFor != nil {
+				md := metadata.MD{}
+				md.Append("x-forwarded-for", tt.forwardedFor...)
+				ctx = metadata.NewIncomingContext(ctx, md)
+			}
+
+			if got := clientIP(ctx); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
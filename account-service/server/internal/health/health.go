@@ -0,0 +1,190 @@
+// Package health reports whether the service and its dependencies are up, over
+// HTTP (/healthz, /readyz) and the standard grpc.health.v1 service.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	checkTimeout  = 2 * time.Second
+	watchInterval = 5 * time.Second
+)
+
+// Check returns an error when a dependency is unavailable.
+type Check func(ctx context.Context) error
+
+type dependency struct {
+	name     string
+	check    Check
+	required bool
+}
+
+// DependencyStatus is served to unauthenticated callers, so it leaves out why a
+// dependency is down; the Checker logs that instead.
+type DependencyStatus struct {
+	Status   string `json:"status"`
+	Required bool   `json:"required"`
+}
+
+type Report struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// Checker is ready while every required dependency is up and the service is
+// not shutting down. Optional dependencies are reported but do not affect
+// readiness.
+type Checker struct {
+	service      string
+	dependencies []dependency
+	shuttingDown atomic.Bool
+	grpcHealth   *health.Server
+	logger       *logrus.Logger
+
+	mu sync.Mutex
+	// down holds the dependencies that were down at the last check, so each
+	// failure and recovery is logged once.
+	down map[string]bool
+}
+
+// NewChecker reports readiness for the gRPC service named service, e.g.
+// "account.AccountService", as well as for the server as a whole.
+func NewChecker(service string, logger *logrus.Logger) *Checker {
+	grpcHealth := health.NewServer()
+	grpcHealth.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	grpcHealth.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	return &Checker{
+		service:    service,
+		grpcHealth: grpcHealth,
+		logger:     logger,
+		down:       make(map[string]bool),
+	}
+}
+
+// Require adds a dependency the service cannot serve without.
+func (c *Checker) Require(name string, check Check) {
+	c.dependencies = append(c.dependencies, dependency{name: name, check: check, required: true})
+}
+
+// Observe adds a dependency whose status is reported without affecting readiness.
+func (c *Checker) Observe(name string, check Check) {
+	c.dependencies = append(c.dependencies, dependency{name: name, check: check})
+}
+
+// GRPCServer is the grpc.health.v1 implementation to register on the gRPC server.
+func (c *Checker) GRPCServer() healthpb.HealthServer {
+	return c.grpcHealth
+}
+
+// Check runs every dependency check concurrently.
+func (c *Checker) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	statuses := make([]DependencyStatus, len(c.dependencies))
+	var wg sync.WaitGroup
+	for i, dep := range c.dependencies {
+		wg.Add(1)
+		go func(i int, dep dependency) {
+			defer wg.Done()
+			statuses[i] = DependencyStatus{Status: "up", Required: dep.required}
+			err := dep.check(ctx)
+			if err != nil {
+				statuses[i].Status = "down"
+			}
+			c.record(dep.name, err)
+		}(i, dep)
+	}
+	wg.Wait()
+
+	report := Report{Status: "ready", Dependencies: make(map[string]DependencyStatus, len(statuses))}
+	for i, dep := range c.dependencies {
+		report.Dependencies[dep.name] = statuses[i]
+		if statuses[i].Required && statuses[i].Status != "up" {
+			report.Status = "not_ready"
+		}
+	}
+	if c.shuttingDown.Load() {
+		report.Status = "shutting_down"
+	}
+	return report
+}
+
+func (c *Checker) record(name string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case err != nil && !c.down[name]:
+		c.logger.WithError(err).WithField("dependency", name).Warn("Dependency is down")
+		c.down[name] = true
+	case err == nil && c.down[name]:
+		c.logger.WithField("dependency", name).Info("Dependency is up again")
+		delete(c.down, name)
+	}
+}
+
+// Watch keeps the gRPC serving status in line with the checks until ctx is
+// cancelled or the service starts shutting down.
+func (c *Checker) Watch(ctx context.Context) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		if c.shuttingDown.Load() {
+			return
+		}
+		status := healthpb.HealthCheckResponse_SERVING
+		if c.Check(ctx).Status != "ready" {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		c.grpcHealth.SetServingStatus("", status)
+		c.grpcHealth.SetServingStatus(c.service, status)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown marks the service as not ready so that load balancers stop sending
+// it new work while in-flight requests drain.
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+	c.grpcHealth.Shutdown()
+}
+
+// LiveHandler answers /healthz: the process is up and serving HTTP.
+func (c *Checker) LiveHandler(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ReadyHandler answers /readyz with the status of every dependency, and 503
+// unless the service is ready.
+func (c *Checker) ReadyHandler(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	report := c.Check(r.Context())
+	code := http.StatusOK
+	if report.Status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, report)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,190 @@
+// Package keys holds the Ed25519 keys account-service signs access tokens with
+// and publishes them as a JSON Web Key Set.
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrNoKeys      = errors.New("no signing keys configured")
+	ErrUnknownKey  = errors.New("unknown signing key")
+	ErrInvalidKey  = errors.New("invalid signing key")
+	ErrUnsupported = errors.New("unexpected signing method")
+)
+
+type SigningKey struct {
+	ID         string
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// KeySet signs with its first key and verifies with any of its keys, so a new
+// key can be introduced while tokens signed with the previous one are still valid.
+type KeySet struct {
+	keys []*SigningKey
+	byID map[string]*SigningKey
+}
+
+// LoadKeySet reads PKCS#8 PEM encoded Ed25519 private keys. The first path is
+// the active signing key; the others are kept for verification during rotation.
+func LoadKeySet(paths []string) (*KeySet, error) {
+	if len(paths) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	keys := make([]*SigningKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := loadKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signing key %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys...)
+}
+
+// GenerateKeySet creates a key set with a single random key. Tokens it signs
+// do not survive a restart, so it is only meant for local development.
+func GenerateKeySet() (*KeySet, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet(newSigningKey(privateKey, publicKey))
+}
+
+func NewKeySet(keys ...*SigningKey) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	byID := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		byID[key.ID] = key
+	}
+	return &KeySet{keys: keys, byID: byID}, nil
+}
+
+func loadKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an Ed25519 key", ErrInvalidKey)
+	}
+	return newSigningKey(privateKey, privateKey.Public().(ed25519.PublicKey)), nil
+}
+
+func newSigningKey(privateKey ed25519.PrivateKey, publicKey ed25519.PublicKey) *SigningKey {
+	return &SigningKey{
+		ID:         thumbprint(publicKey),
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	}
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint of publicKey, used as its kid.
+func thumbprint(publicKey ed25519.PublicKey) string {
+	canonical := fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64.RawURLEncoding.EncodeToString(publicKey))
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Sign signs claims with the active key and records its kid in the header.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	active := s.keys[0]
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = active.ID
+	return token.SignedString(active.PrivateKey)
+}
+
+// Keyfunc resolves the verification key of a token from its kid.
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.byID[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key.PublicKey, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// JWKS returns the public keys of the set as an RFC 7517 JSON Web Key Set.
+func (s *KeySet) JWKS() ([]byte, error) {
+	set := jwks{Keys: make([]jwk, 0, len(s.keys))}
+	for _, key := range s.keys {
+		set.Keys = append(set.Keys, jwk{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key.PublicKey),
+			Kid: key.ID,
+			Alg: "EdDSA",
+			Use: "sig",
+		})
+	}
+	return json.Marshal(set)
+}
+
+// GenerateKeyFile writes a new PKCS#8 PEM encoded Ed25519 private key to path
+// and returns its kid. Existing files are never overwritten.
+func GenerateKeyFile(path string) (string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		_ = file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	return thumbprint(publicKey), nil
+}
@@ -0,0 +1,122 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func generateKey(t *testing.T) *SigningKey {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return newSigningKey(privateKey, publicKey)
+}
+
+func signWith(t *testing.T, key *SigningKey, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{Subject: "acc-a"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestKeySetSignsWithActiveKey(t *testing.T) {
+	active, previous := generateKey(t), generateKey(t)
+	set, err := NewKeySet(active, previous)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	signed, err := set.Sign(jwt.RegisteredClaims{Subject: "acc-a"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	token, err := jwt.Parse(signed, set.Keyfunc)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if kid := token.Header["kid"]; kid != active.ID {
+		t.Errorf("kid = %v, want the active key %s", kid, active.ID)
+	}
+}
+
+func TestKeySetKeyfunc(t *testing.T) {
+	active, previous, retired := generateKey(t), generateKey(t), generateKey(t)
+	set, err := NewKeySet(active, previous)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "active key", token: signWith(t, active, active.ID)},
+		{name: "previous key during rotation", token: signWith(t, previous, previous.ID)},
+		{name: "retired key", token: signWith(t, retired, retired.ID), wantErr: ErrUnknownKey},
+		{name: "no kid", token: signWith(t, active, ""), wantErr: ErrUnknownKey},
+		// The key is picked by kid alone, so a token claiming one key but
+		// signed with another fails verification.
+		{name: "kid of another key", token: signWith(t, previous, active.ID), wantErr: jwt.ErrEd25519Verification},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, set.Keyfunc)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "acc-a"})
+	hmac.Header["kid"] = active.ID
+	signed, err := hmac.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	if _, err := jwt.Parse(signed, set.Keyfunc); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Parse() of an HS256 token error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestKeySetJWKS(t *testing.T) {
+	active, previous := generateKey(t), generateKey(t)
+	set, err := NewKeySet(active, previous)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+
+	data, err := set.JWKS()
+	if err != nil {
+		t.Fatalf("JWKS() error = %v", err)
+	}
+	var published jwks
+	if err := json.Unmarshal(data, &published); err != nil {
+		t.Fatalf("JWKS does not decode: %v", err)
+	}
+	if len(published.Keys) != 2 || published.Keys[0].Kid != active.ID || published.Keys[1].Kid != previous.ID {
+		t.Fatalf("published %+v, want the active and previous keys", published.Keys)
+	}
+	for _, key := range published.Keys {
+		if key.Kty != "OKP" || key.Crv != "Ed25519" || key.Alg != "EdDSA" || key.Use != "sig" {
+			t.Errorf("published key %+v", key)
+		}
+	}
+}
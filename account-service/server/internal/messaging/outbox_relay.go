@@ -0,0 +1,122 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
+	"github.com/zuyatna/emoney-microservice/account-service/server/repository"
+	"github.com/zuyatna/emoney-microservice/account-service/server/usecase"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 100
+	// Published events are kept for outboxRetention, for debugging, and
+	// deleted every outboxPruneInterval.
+	outboxRetention     = 7 * 24 * time.Hour
+	outboxPruneInterval = time.Hour
+)
+
+var outboxDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "outbox_dead_lettered_total",
+	Help: "Outbox events parked after running out of attempts or failing for good, by routing key.",
+}, []string{"routing_key"})
+
+// OutboxRelay publishes events written to the outbox table, giving downstream
+// services at-least-once delivery of everything account-service commits.
+type OutboxRelay struct {
+	repo      repository.OutboxRepository
+	tokens    usecase.TokenIssuer
+	publisher domain.EventPublisher
+	logger    *logrus.Logger
+}
+
+// NewOutboxRelay publishes events with publisher, letting tokens issue the
+// one-time tokens of the events that carry one as they are published.
+func NewOutboxRelay(repo repository.OutboxRepository, tokens usecase.TokenIssuer, publisher domain.EventPublisher, logger *logrus.Logger) *OutboxRelay {
+	return &OutboxRelay{
+		repo:      repo,
+		tokens:    tokens,
+		publisher: publisher,
+		logger:    logger,
+	}
+}
+
+// Run relays pending events until ctx is cancelled. A full batch is followed
+// immediately by the next one so a backlog drains without waiting for the ticker.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		if time.Since(lastPrune) >= outboxPruneInterval {
+			r.prune(ctx)
+			lastPrune = time.Now()
+		}
+
+		batch, err := r.repo.ProcessPending(ctx, outboxBatchSize, func(ctx context.Context, event *domain.OutboxEvent) error {
+			// Publish as part of the trace of the request that wrote the event.
+			ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(event.TraceContext))
+			payload, publish, err := r.tokens.Issue(ctx, event)
+			if err == nil && publish {
+				err = r.publisher.Publish(ctx, event.RoutingKey, event.ID, payload)
+			}
+			if err != nil && ctx.Err() == nil {
+				r.logger.WithError(err).WithFields(logrus.Fields{
+					"event_id":    event.ID,
+					"routing_key": event.RoutingKey,
+					"attempts":    event.Attempts + 1,
+				}).Warn("Error relaying outbox event")
+			}
+			// A dropped event is marked as published all the same.
+			return err
+		})
+		if err != nil && ctx.Err() == nil {
+			r.logger.WithError(err).Error("Error relaying outbox events")
+		}
+		for _, event := range batch.DeadLettered {
+			outboxDeadLettered.WithLabelValues(event.RoutingKey).Inc()
+			r.logger.WithFields(logrus.Fields{
+				"event_id":    event.ID,
+				"routing_key": event.RoutingKey,
+				"attempts":    event.Attempts,
+				"error":       event.LastError,
+			}).Error("Dead-lettered outbox event")
+		}
+		if batch.Published > 0 {
+			r.logger.WithField("published", batch.Published).Info("Relayed outbox events")
+		}
+		// A full batch may have left more due events behind, even if some of
+		// its own were skipped or failed.
+		if err == nil && batch.Fetched == outboxBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *OutboxRelay) prune(ctx context.Context) {
+	deleted, err := r.repo.DeletePublished(ctx, time.Now().Add(-outboxRetention))
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.WithError(err).Error("Error pruning published outbox events")
+		}
+		return
+	}
+	if deleted > 0 {
+		r.logger.WithField("deleted", deleted).Info("Pruned published outbox events")
+	}
+}
@@ -1,18 +1,22 @@
 package messaging
 
 import (
+	"sync"
+
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/sirupsen/logrus"
 )
 
 const exchangeName = "emoney_exchange"
-const accountCreatedRoutingKey = "account.created"
 
 type AccountPublisher struct {
 	ch     *amqp.Channel
+	mu     sync.Mutex
 	logger *logrus.Logger
 }
 
+// NewAccountPublisher opens a channel in confirm mode, so every publish waits
+// for the broker to take responsibility for the message.
 func NewAccountPublisher(conn *amqp.Connection, logger *logrus.Logger) (*AccountPublisher, error) {
 	ch, err := conn.Channel()
 	if err != nil {
@@ -36,8 +40,19 @@ func NewAccountPublisher(conn *amqp.Connection, logger *logrus.Logger) (*Account
 		return nil, err
 	}
 
+	if err := ch.Confirm(false); err != nil {
+		if closeErr := ch.Close(); closeErr != nil {
+			return nil, closeErr
+		}
+		return nil, err
+	}
+
 	return &AccountPublisher{
 		ch:     ch,
 		logger: logger,
 	}, nil
 }
+
+func (p *AccountPublisher) Close() error {
+	return p.ch.Close()
+}
@@ -2,36 +2,89 @@ package messaging
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type AccountCreatedEvent struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-}
+var errPublishNacked = errors.New("broker did not acknowledge message")
 
-func (p *AccountPublisher) PublishAccountCreated(ctx context.Context, id, name, email string) error {
-	event := &AccountCreatedEvent{ID: id, Name: name, Email: email}
-	body, err := json.Marshal(event)
-	if err != nil {
-		p.logger.Errorf("failed to marshal account created event: %v", err)
+var (
+	published = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_published_total",
+		Help: "Messages confirmed by RabbitMQ, by routing key.",
+	}, []string{"routing_key"})
+	publishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_publish_failures_total",
+		Help: "Messages RabbitMQ failed to accept or confirm, by routing key.",
+	}, []string{"routing_key"})
+)
+
+// Publish sends a persistent message and blocks until the broker confirms it.
+// The trace context of ctx travels with the message in its headers.
+func (p *AccountPublisher) Publish(ctx context.Context, routingKey, messageID string, body []byte) error {
+	ctx, span := tracer.Start(ctx, routingKey+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", exchangeName),
+			attribute.String("messaging.rabbitmq.destination.routing_key", routingKey),
+			attribute.String("messaging.message.id", messageID),
+		),
+	)
+	defer span.End()
+
+	if err := p.publish(ctx, routingKey, messageID, body); err != nil {
+		publishFailures.WithLabelValues(routingKey).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
+	published.WithLabelValues(routingKey).Inc()
+	return nil
+}
 
-	p.logger.WithFields(logrus.Fields{"routing_key": accountCreatedRoutingKey, "account_id": id}).Info("Publishing account created event")
+func (p *AccountPublisher) publish(ctx context.Context, routingKey, messageID string, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	return p.ch.PublishWithContext(
+	p.logger.WithFields(logrus.Fields{"routing_key": routingKey, "message_id": messageID}).Info("Publishing event")
+
+	headers := amqp.Table{}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+
+	confirmation, err := p.ch.PublishWithDeferredConfirmWithContext(
 		ctx,
 		exchangeName,
-		accountCreatedRoutingKey,
+		routingKey,
 		false, // Mandatory
 		false, // Immediate
 		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
+			Headers:      headers,
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    messageID,
+			Body:         body,
 		},
 	)
+	if err != nil {
+		return fmt.Errorf("failed to publish %s: %w", routingKey, err)
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to confirm %s: %w", routingKey, err)
+	}
+	if !acked {
+		return fmt.Errorf("%w: %s", errPublishNacked, routingKey)
+	}
+	return nil
 }
@@ -0,0 +1,93 @@
+// Package wallet calls transaction-service, which holds account balances.
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/zuyatna/emoney-microservice/account-service/server/apperr"
+	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
+	transactionpb "github.com/zuyatna/emoney-microservice/account-service/server/transaction-service/pb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// serviceTokenExpires is how long a token signed for a single call is valid.
+const serviceTokenExpires = time.Minute
+
+var (
+	ErrBalanceNotZero = apperr.New(apperr.ErrFailedPrecondition, "BALANCE_NOT_ZERO", "account balance must be zero to close it")
+	ErrWalletNotReady = apperr.New(apperr.ErrFailedPrecondition, "WALLET_NOT_READY", "wallet is not set up yet, try again shortly")
+)
+
+type Client struct {
+	client transactionpb.TransactionServiceClient
+	signer domain.TokenSigner
+}
+
+func NewClient(conn grpc.ClientConnInterface, signer domain.TokenSigner) *Client {
+	return &Client{
+		client: transactionpb.NewTransactionServiceClient(conn),
+		signer: signer,
+	}
+}
+
+// CloseWallet closes the wallet of accountID. transaction-service only lets
+// account-service do this, so the call is authenticated with a short-lived
+// token account-service signs for itself rather than the owner's; the caller
+// must already have checked that the owner asked for it.
+func (c *Client) CloseWallet(ctx context.Context, accountID string) error {
+	token, err := c.serviceToken(domain.ScopeCloseWallet)
+	if err != nil {
+		return err
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+
+	_, err = c.client.CloseWallet(ctx, &transactionpb.CloseWalletRequest{AccountId: accountID})
+	if err == nil {
+		return nil
+	}
+
+	st := status.Convert(err)
+	switch {
+	case reason(st) == "BALANCE_NOT_ZERO":
+		return ErrBalanceNotZero
+	case st.Code() == codes.NotFound:
+		// The account.created event has not reached transaction-service yet.
+		return ErrWalletNotReady
+	}
+	return err
+}
+
+func (c *Client) serviceToken(scope string) (string, error) {
+	now := time.Now()
+	token, err := c.signer.Sign(&domain.CustomClaim{
+		Scope: scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "account-service",
+			Subject:   "account-service",
+			Audience:  jwt.ClaimStrings{"transaction-service"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(serviceTokenExpires)),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign service token: %w", err)
+	}
+	return token, nil
+}
+
+// reason returns the ErrorInfo reason transaction-service attached to st.
+func reason(st *status.Status) string {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+	return ""
+}
@@ -3,16 +3,52 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"github.com/zuyatna/emoney-microservice/account-service/server/config"
+	"github.com/zuyatna/emoney-microservice/account-service/server/handler"
+	"github.com/zuyatna/emoney-microservice/account-service/server/internal/health"
+	"github.com/zuyatna/emoney-microservice/account-service/server/internal/keys"
+	"github.com/zuyatna/emoney-microservice/account-service/server/internal/messaging"
+	"github.com/zuyatna/emoney-microservice/account-service/server/internal/tracing"
+	"github.com/zuyatna/emoney-microservice/account-service/server/internal/wallet"
+	"github.com/zuyatna/emoney-microservice/account-service/server/middleware"
+	"github.com/zuyatna/emoney-microservice/account-service/server/pb"
+	"github.com/zuyatna/emoney-microservice/account-service/server/repository"
+	"github.com/zuyatna/emoney-microservice/account-service/server/usecase"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	defaultJWTExpires          = 15 * time.Minute
+	defaultRefreshExpires      = 30 * 24 * time.Hour
+	defaultVerificationExpires = 24 * time.Hour
+	defaultResetExpires        = time.Hour
+	shutdownTimeout            = 10 * time.Second
+	jwksCacheControl           = "public, max-age=300"
 )
 
 func main() {
@@ -27,6 +63,31 @@ func main() {
 		Action: func(c *cli.Context) error {
 			return runService(logger)
 		},
+		Commands: []cli.Command{
+			migrateCommand(logger),
+			{
+				Name:  "keys",
+				Usage: "Manage JWT signing keys",
+				Subcommands: []cli.Command{
+					{
+						Name:      "generate",
+						Usage:     "Write a new Ed25519 signing key as PKCS#8 PEM",
+						ArgsUsage: "<path>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								return cli.NewExitError("expected the path of the key file", 1)
+							}
+							kid, err := keys.GenerateKeyFile(c.Args().First())
+							if err != nil {
+								return err
+							}
+							logger.WithField("kid", kid).Info("Signing key generated")
+							return nil
+						},
+					},
+				},
+			},
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -34,6 +95,23 @@ func main() {
 	}
 }
 
+// loadKeySet loads the configured signing keys. Without any, an ephemeral key
+// is generated so the service still starts locally, but every token it issues
+// becomes invalid on restart.
+func loadKeySet(cfg config.Config, logger *logrus.Logger) (*keys.KeySet, error) {
+	var paths []string
+	for _, path := range strings.Split(cfg.JWTKeyFiles, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		logger.Warn("JWT_SIGNING_KEY_FILES is not set, signing tokens with an ephemeral key")
+		return keys.GenerateKeySet()
+	}
+	return keys.LoadKeySet(paths)
+}
+
 func runService(logger *logrus.Logger) error {
 	cfg, err := config.LoadConfig("..")
 	if err != nil {
@@ -41,7 +119,19 @@ func runService(logger *logrus.Logger) error {
 	}
 
 	ctx := context.Background()
-	db, err := sql.Open("postgres", cfg.PostgresURL)
+	shutdownTracing, err := tracing.Setup(ctx, "account-service", cfg.TracesExporter, cfg.OTLPEndpoint)
+	if err != nil {
+		logger.Fatalf("Error setting up tracing: %v", err)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			logger.WithError(err).Error("Error flushing traces")
+		}
+	}()
+
+	db, err := tracing.OpenPostgres(cfg.PostgresURL)
 	if err != nil {
 		logger.Fatalf("Error connecting to PostgreSQL: %v", err)
 	}
@@ -64,6 +154,10 @@ func runService(logger *logrus.Logger) error {
 		logger.Fatalf("Error parsing Redis URL: %v", err)
 	}
 	redisClient := redis.NewClient(redisOpts)
+	// Commands are left out of spans: cached accounts include password hashes.
+	if err := redisotel.InstrumentTracing(redisClient, redisotel.WithDBStatement(false)); err != nil {
+		logger.Fatalf("Error instrumenting Redis: %v", err)
+	}
 	if _, err := redisClient.Ping(ctx).Result(); err != nil {
 		logger.Fatalf("Error connecting to Redis: %v", err)
 	}
@@ -81,10 +175,216 @@ func runService(logger *logrus.Logger) error {
 	}(rabbitConn)
 	logger.Println("Connected to RabbitMQ")
 
+	publisher, err := messaging.NewAccountPublisher(rabbitConn, logger)
+	if err != nil {
+		logger.Fatalf("Error creating account publisher: %v", err)
+	}
+	defer func(publisher *messaging.AccountPublisher) {
+		if err := publisher.Close(); err != nil {
+			logger.WithError(err).Error("Error closing publisher channel")
+		}
+	}(publisher)
+
+	transactionServiceConn, err := grpc.NewClient(cfg.TransactionServiceTarget,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+	)
+	if err != nil {
+		logger.Fatalf("Error connecting to transaction service: %v", err)
+	}
+	defer func(transactionServiceConn *grpc.ClientConn) {
+		if err := transactionServiceConn.Close(); err != nil {
+			logger.WithError(err).Error("Error closing transaction service connection")
+		}
+	}(transactionServiceConn)
+
+	jwtExpires := cfg.JWTExpires
+	if jwtExpires <= 0 {
+		jwtExpires = defaultJWTExpires
+	}
+	refreshExpires := cfg.RefreshExpires
+	if refreshExpires <= 0 {
+		refreshExpires = defaultRefreshExpires
+	}
+	verificationExpires := cfg.VerificationExpires
+	if verificationExpires <= 0 {
+		verificationExpires = defaultVerificationExpires
+	}
+	resetExpires := cfg.PasswordResetExpires
+	if resetExpires <= 0 {
+		resetExpires = defaultResetExpires
+	}
+
+	keySet, err := loadKeySet(cfg, logger)
+	if err != nil {
+		logger.Fatalf("Error loading JWT signing keys: %v", err)
+	}
+	jwks, err := keySet.JWKS()
+	if err != nil {
+		logger.Fatalf("Error encoding JWKS: %v", err)
+	}
+
+	accountRepo := repository.NewAccountRepository(db, redisClient)
+	tokenRepo := repository.NewTokenRepository(redisClient)
+	rateLimitRepo := repository.NewRateLimitRepository(redisClient)
+	accountUseCase := usecase.NewAccountUseCase(accountRepo, tokenRepo, rateLimitRepo, wallet.NewClient(transactionServiceConn, keySet), keySet, jwtExpires, refreshExpires)
+	accountHandler := handler.NewAccountHandler(accountUseCase, logrus.NewEntry(logger))
+	authInterceptor := middleware.NewAuthInterceptor(keySet.Keyfunc, tokenRepo.IsFamilyActive, logger)
+
+	checker := health.NewChecker(pb.AccountService_ServiceDesc.ServiceName, logger)
+	checker.Require("postgres", db.PingContext)
+	checker.Require("redis", func(ctx context.Context) error {
+		return redisClient.Ping(ctx).Err()
+	})
+	checker.Require("rabbitmq", func(ctx context.Context) error {
+		if rabbitConn.IsClosed() {
+			return amqp.ErrClosed
+		}
+		return nil
+	})
+	// Only closing an account needs transaction-service, so it does not affect
+	// readiness; requiring it would also keep both services unready whenever
+	// either is down, since transaction-service observes this one.
+	transactionHealth := healthpb.NewHealthClient(transactionServiceConn)
+	checker.Observe("transaction-service", func(ctx context.Context) error {
+		resp, err := transactionHealth.Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("transaction service is %s", resp.GetStatus())
+		}
+		return nil
+	})
+
+	metricsInterceptor := middleware.NewMetricsInterceptor()
+	errorInterceptor := middleware.NewErrorInterceptor("account-service", logger)
+	validationInterceptor, err := middleware.NewValidationInterceptor(logger)
+	if err != nil {
+		logger.Fatalf("Error creating request validator: %v", err)
+	}
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "account"))
+
+	grpcServer := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+		grpc.ChainUnaryInterceptor(metricsInterceptor.Unary(), errorInterceptor.Unary(), authInterceptor.Unary(), validationInterceptor.Unary()),
+	)
+	pb.RegisterAccountServiceServer(grpcServer, accountHandler)
+	healthpb.RegisterHealthServer(grpcServer, checker.GRPCServer())
+
+	grpcListener, err := net.Listen("tcp", ":"+cfg.GRPCPORT)
+	if err != nil {
+		logger.Fatalf("Error listening on gRPC port %s: %v", cfg.GRPCPORT, err)
+	}
+
+	relayCtx, cancelRelay := context.WithCancel(ctx)
+	relayDone := make(chan struct{})
+	outboxRelay := messaging.NewOutboxRelay(repository.NewOutboxRepository(db), usecase.NewTokenIssuer(accountRepo, verificationExpires, resetExpires), publisher, logger)
+	go func() {
+		defer close(relayDone)
+		outboxRelay.Run(relayCtx)
+	}()
+
+	gatewayCtx, cancelGateway := context.WithCancel(ctx)
+	defer cancelGateway()
+
+	go checker.Watch(gatewayCtx)
+
+	gatewayMux := runtime.NewServeMux(runtime.WithErrorHandler(middleware.GatewayErrorHandler))
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+	}
+	if err := pb.RegisterAccountServiceHandlerFromEndpoint(gatewayCtx, gatewayMux, "localhost:"+cfg.GRPCPORT, dialOpts); err != nil {
+		logger.Fatalf("Error registering gRPC gateway: %v", err)
+	}
+	err = gatewayMux.HandlePath(http.MethodGet, "/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", jwksCacheControl)
+		_, _ = w.Write(jwks)
+	})
+	if err != nil {
+		logger.Fatalf("Error registering JWKS route: %v", err)
+	}
+	err = gatewayMux.HandlePath(http.MethodGet, "/metrics", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		promhttp.Handler().ServeHTTP(w, r)
+	})
+	if err != nil {
+		logger.Fatalf("Error registering metrics route: %v", err)
+	}
+	if err := gatewayMux.HandlePath(http.MethodGet, "/healthz", checker.LiveHandler); err != nil {
+		logger.Fatalf("Error registering health route: %v", err)
+	}
+	if err := gatewayMux.HandlePath(http.MethodGet, "/readyz", checker.ReadyHandler); err != nil {
+		logger.Fatalf("Error registering readiness route: %v", err)
+	}
+	httpServer := &http.Server{
+		Addr:              ":" + cfg.HTTPPort,
+		Handler:           otelhttp.NewHandler(gatewayMux, "gateway", otelhttp.WithFilter(tracedRequest)),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	serverErrors := make(chan error, 2)
+	go func() {
+		logger.Infof("gRPC server listening on :%s", cfg.GRPCPORT)
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			serverErrors <- err
+		}
+	}()
+	go func() {
+		logger.Infof("HTTP gateway listening on :%s", cfg.HTTPPort)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErrors <- err
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+	case err := <-serverErrors:
+		logger.WithError(err).Error("Server stopped unexpectedly")
+	}
 	logger.Warn("Shutting down gracefully...")
 
+	// Report not-ready first and give load balancers time to notice before the
+	// listeners close.
+	checker.Shutdown()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.WithError(err).Error("Error shutting down HTTP gateway")
+	}
+	stopGRPCServer(shutdownCtx, grpcServer)
+	cancelRelay()
+	<-relayDone
+	logger.Info("Servers stopped")
+
 	return nil
 }
+
+// tracedRequest leaves probes and scrapes out of traces.
+func tracedRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
+}
+
+// stopGRPCServer drains in-flight RPCs, falling back to a hard stop once ctx expires.
+func stopGRPCServer(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
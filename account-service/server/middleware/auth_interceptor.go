@@ -12,23 +12,38 @@ import (
 	"strings"
 )
 
+// SessionChecker reports whether the session an access token was issued for,
+// its refresh token family, is still active.
+type SessionChecker func(ctx context.Context, sessionID string) (bool, error)
+
 type AuthInterceptor struct {
-	jwtSecret string
-	logger    *logrus.Logger
+	keyfunc       jwt.Keyfunc
+	sessionActive SessionChecker
+	logger        *logrus.Logger
 }
 
-func NewAuthInterceptor(jwtSecret string, logger *logrus.Logger) *AuthInterceptor {
+// NewAuthInterceptor verifies tokens with the key keyfunc resolves from their
+// kid, and rejects tokens whose session was revoked by logging out, changing or
+// resetting the password, or closing the account, even before they expire.
+func NewAuthInterceptor(keyfunc jwt.Keyfunc, sessionActive SessionChecker, logger *logrus.Logger) *AuthInterceptor {
 	return &AuthInterceptor{
-		jwtSecret: jwtSecret,
-		logger:    logger,
+		keyfunc:       keyfunc,
+		sessionActive: sessionActive,
+		logger:        logger,
 	}
 }
 
 func (i *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		publicMethods := map[string]bool{
-			"/pb.AccountService/CreateAccount": true,
-			"/pb.AccountService/Login":         true,
+			"/account.AccountService/CreateAccount":        true,
+			"/account.AccountService/Login":                true,
+			"/account.AccountService/RefreshToken":         true,
+			"/account.AccountService/Logout":               true,
+			"/account.AccountService/VerifyEmail":          true,
+			"/account.AccountService/RequestPasswordReset": true,
+			"/account.AccountService/ResetPassword":        true,
+			"/grpc.health.v1.Health/Check":                 true,
 		}
 
 		if publicMethods[info.FullMethod] {
@@ -65,21 +80,25 @@ func (i *AuthInterceptor) authorize(ctx context.Context) (*domain.CustomClaim, e
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
 	claims := &domain.CustomClaim{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, status.Errorf(codes.Unauthenticated, "unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(i.jwtSecret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, i.keyfunc)
 	if err != nil {
 		i.logger.WithError(err).Error("JWT parsing error")
 		return nil, status.Error(codes.Unauthenticated, "token is invalid")
 	}
 
-	if !token.Valid {
+	if !token.Valid || claims.SessionID == "" {
 		i.logger.Error("JWT token is not valid")
 		return nil, status.Error(codes.Unauthenticated, "token is not valid")
 	}
 
+	active, err := i.sessionActive(ctx, claims.SessionID)
+	if err != nil {
+		i.logger.WithError(err).Error("Error checking session")
+		return nil, status.Error(codes.Unavailable, "could not check session")
+	}
+	if !active {
+		return nil, status.Error(codes.Unauthenticated, "session was signed out")
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/account-service/server/apperr"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorCodes is the gRPC code each kind of apperr error is reported with.
+var errorCodes = []struct {
+	kind error
+	code codes.Code
+}{
+	{apperr.ErrNotFound, codes.NotFound},
+	{apperr.ErrAlreadyExists, codes.AlreadyExists},
+	{apperr.ErrInvalidArgument, codes.InvalidArgument},
+	{apperr.ErrInvalidCredentials, codes.Unauthenticated},
+	{apperr.ErrUnauthenticated, codes.Unauthenticated},
+	{apperr.ErrPermissionDenied, codes.PermissionDenied},
+	{apperr.ErrInsufficientFunds, codes.FailedPrecondition},
+	{apperr.ErrFailedPrecondition, codes.FailedPrecondition},
+	{apperr.ErrRateLimited, codes.ResourceExhausted},
+}
+
+type ErrorInterceptor struct {
+	domain string
+	logger *logrus.Logger
+}
+
+// NewErrorInterceptor reports errors with google.rpc.ErrorInfo details in
+// domain, e.g. "account-service".
+func NewErrorInterceptor(domain string, logger *logrus.Logger) *ErrorInterceptor {
+	return &ErrorInterceptor{
+		domain: domain,
+		logger: logger,
+	}
+}
+
+// Unary turns the errors handlers return into gRPC statuses. apperr errors
+// get their kind's code, their message and an ErrorInfo carrying their reason;
+// any other error is logged and reported as Internal without its message.
+// Errors that already are statuses are returned unchanged.
+func (i *ErrorInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		return nil, i.status(info.FullMethod, err)
+	}
+}
+
+func (i *ErrorInterceptor) status(method string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		st := status.New(errorCode(appErr.Kind()), appErr.Error())
+		detailed, detailErr := st.WithDetails(&errdetails.ErrorInfo{Reason: appErr.Reason(), Domain: i.domain})
+		if detailErr != nil {
+			return st.Err()
+		}
+		return detailed.Err()
+	}
+	for _, c := range errorCodes {
+		if errors.Is(err, c.kind) {
+			return status.Error(c.code, c.kind.Error())
+		}
+	}
+
+	i.logger.WithError(err).WithField("method", method).Error("Internal error")
+	return status.Error(codes.Internal, "internal error")
+}
+
+func errorCode(kind error) codes.Code {
+	for _, c := range errorCodes {
+		if kind == c.kind {
+			return c.code
+		}
+	}
+	return codes.Internal
+}
+
+// GatewayErrorHandler writes gRPC errors as HTTP responses like the gateway's
+// default handler does, except that FailedPrecondition, such as insufficient
+// funds, is 422 Unprocessable Entity rather than 400 Bad Request.
+func GatewayErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if status.Code(err) == codes.FailedPrecondition {
+		err = &runtime.HTTPStatusError{HTTPStatus: http.StatusUnprocessableEntity, Err: err}
+	}
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+}
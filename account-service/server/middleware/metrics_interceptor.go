@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	rpcHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "RPCs completed on the server, by method and status code.",
+	}, []string{"grpc_service", "grpc_method", "grpc_code"})
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Time taken to handle RPCs, by method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_service", "grpc_method", "grpc_code"})
+)
+
+type MetricsInterceptor struct{}
+
+func NewMetricsInterceptor() *MetricsInterceptor {
+	return &MetricsInterceptor{}
+}
+
+// Unary records the latency and status code of every call, including calls
+// rejected by the interceptors that run after it.
+func (i *MetricsInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		service, method := splitMethod(info.FullMethod)
+		code := status.Code(err).String()
+		rpcHandled.WithLabelValues(service, method, code).Inc()
+		rpcDuration.WithLabelValues(service, method, code).Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+}
+
+// splitMethod splits "/package.Service/Method" into its service and method.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
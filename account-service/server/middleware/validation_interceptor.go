@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"buf.build/go/protovalidate"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type ValidationInterceptor struct {
+	validator protovalidate.Validator
+	logger    *logrus.Logger
+}
+
+// NewValidationInterceptor enforces the buf.validate rules declared on the
+// request messages in the .proto files.
+func NewValidationInterceptor(logger *logrus.Logger) (*ValidationInterceptor, error) {
+	validator, err := protovalidate.New()
+	if err != nil {
+		return nil, err
+	}
+	return &ValidationInterceptor{
+		validator: validator,
+		logger:    logger,
+	}, nil
+}
+
+// Unary rejects requests that break their rules with InvalidArgument and a
+// google.rpc.BadRequest detail listing every violation by field, before the
+// handler runs.
+func (i *ValidationInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		err := i.validator.Validate(msg)
+		if err == nil {
+			return handler(ctx, req)
+		}
+
+		var validationErr *protovalidate.ValidationError
+		if !errors.As(err, &validationErr) {
+			// The rules themselves are broken, e.g. a CEL expression that does not compile.
+			i.logger.WithError(err).WithField("method", info.FullMethod).Error("Error validating request")
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+		return nil, invalidArgument(validationErr)
+	}
+}
+
+func invalidArgument(validationErr *protovalidate.ValidationError) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range validationErr.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       protovalidate.FieldPathString(violation.Proto.GetField()),
+			Description: violation.Proto.GetMessage(),
+			Reason:      violation.Proto.GetRuleId(),
+		})
+	}
+
+	st := status.New(codes.InvalidArgument, "invalid request")
+	detailed, err := st.WithDetails(badRequest)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
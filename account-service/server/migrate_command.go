@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/zuyatna/emoney-microservice/account-service/server/config"
+	"github.com/zuyatna/emoney-microservice/account-service/server/internal/migrate"
+	"github.com/zuyatna/emoney-microservice/account-service/server/migrations"
+)
+
+// migrationLockID is the Postgres advisory lock held while migrating. It is
+// unique per service so both can migrate a shared server at the same time.
+const migrationLockID = 4017210001
+
+func migrateCommand(logger *logrus.Logger) cli.Command {
+	return cli.Command{
+		Name:  "migrate",
+		Usage: "Apply, revert and inspect the database migrations embedded in this binary",
+		Subcommands: []cli.Command{
+			{
+				Name:  "up",
+				Usage: "Apply every pending migration",
+				Action: func(c *cli.Context) error {
+					return withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+						applied, err := m.Up(ctx)
+						for _, migration := range applied {
+							logger.WithField("version", migration.Version).WithField("name", migration.Name).Info("Migration applied")
+						}
+						if err == nil && len(applied) == 0 {
+							logger.Info("Database is up to date")
+						}
+						return err
+					})
+				},
+			},
+			{
+				Name:  "down",
+				Usage: "Revert the latest applied migrations",
+				Flags: []cli.Flag{
+					cli.IntFlag{
+						Name:  "steps",
+						Value: 1,
+						Usage: "number of migrations to revert",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+						reverted, err := m.Down(ctx, c.Int("steps"))
+						for _, migration := range reverted {
+							logger.WithField("version", migration.Version).WithField("name", migration.Name).Info("Migration reverted")
+						}
+						return err
+					})
+				},
+			},
+			{
+				Name:  "status",
+				Usage: "List migrations and whether they are applied",
+				Action: func(c *cli.Context) error {
+					return withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+						statuses, err := m.Status(ctx)
+						if err != nil {
+							return err
+						}
+						for _, status := range statuses {
+							entry := logger.WithField("version", status.Version).WithField("name", status.Name)
+							if status.AppliedAt == nil {
+								entry.Info("Pending")
+								continue
+							}
+							entry.WithField("applied_at", status.AppliedAt).Info("Applied")
+						}
+						return nil
+					})
+				},
+			},
+			{
+				Name:      "force",
+				Usage:     "Mark migrations up to VERSION as applied without running them, e.g. for a schema migrated by hand",
+				ArgsUsage: "<version>",
+				Action: func(c *cli.Context) error {
+					version, err := strconv.ParseInt(c.Args().First(), 10, 64)
+					if err != nil {
+						return cli.NewExitError("expected the version to force", 1)
+					}
+					return withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+						if err := m.Force(ctx, version); err != nil {
+							return err
+						}
+						logger.WithField("version", version).Info("Migration version forced")
+						return nil
+					})
+				},
+			},
+		},
+	}
+}
+
+func withMigrator(fn func(ctx context.Context, m *migrate.Migrator) error) error {
+	cfg, err := config.LoadConfig("..")
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open("postgres", cfg.PostgresURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, migrations.FS, migrationLockID)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, m)
+}
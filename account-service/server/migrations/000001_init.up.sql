@@ -0,0 +1,10 @@
+-- Schema as of the first release.
+CREATE TABLE accounts (
+    id         TEXT PRIMARY KEY,
+    name       TEXT             NOT NULL,
+    email      TEXT             NOT NULL UNIQUE,
+    password   TEXT             NOT NULL,
+    balance    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+ALTER TABLE accounts
+    DROP COLUMN currency,
+    ALTER COLUMN balance TYPE DOUBLE PRECISION USING balance / 100.0;
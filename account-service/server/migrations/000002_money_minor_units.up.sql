@@ -0,0 +1,7 @@
+-- Convert floating point balances to integer minor units.
+-- Every account created before this migration is in IDR, which has two
+-- minor-unit digits, so balances are scaled by 100.
+ALTER TABLE accounts
+    ALTER COLUMN balance TYPE BIGINT USING ROUND(balance * 100)::BIGINT,
+    ALTER COLUMN balance SET DEFAULT 0,
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR';
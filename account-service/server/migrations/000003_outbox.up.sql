@@ -0,0 +1,14 @@
+-- Transactional outbox. Events are inserted in the same transaction as the
+-- change they describe and published by the outbox relay.
+CREATE TABLE outbox (
+    id           UUID PRIMARY KEY,
+    aggregate_id TEXT        NOT NULL,
+    routing_key  TEXT        NOT NULL,
+    payload      JSONB       NOT NULL,
+    attempts     INTEGER     NOT NULL DEFAULT 0,
+    last_error   TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (created_at) WHERE published_at IS NULL;
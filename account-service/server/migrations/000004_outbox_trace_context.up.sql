@@ -0,0 +1,3 @@
+-- W3C trace context of the request that wrote the event, so the published
+-- message continues its trace.
+ALTER TABLE outbox ADD COLUMN trace_context JSONB NOT NULL DEFAULT '{}';
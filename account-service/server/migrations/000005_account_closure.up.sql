@@ -0,0 +1,2 @@
+-- Closed accounts are kept for their history but can no longer sign in.
+ALTER TABLE accounts ADD COLUMN closed_at TIMESTAMPTZ;
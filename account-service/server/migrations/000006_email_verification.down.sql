@@ -0,0 +1,3 @@
+DROP TABLE email_verification_tokens;
+
+ALTER TABLE accounts DROP COLUMN email_verified_at;
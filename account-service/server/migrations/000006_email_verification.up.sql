@@ -0,0 +1,17 @@
+-- New accounts start unverified. Accounts created before this migration are
+-- treated as verified since they signed up, so existing users keep making
+-- large transfers without first confirming an address they already use.
+ALTER TABLE accounts ADD COLUMN email_verified_at TIMESTAMPTZ;
+UPDATE accounts SET email_verified_at = created_at;
+
+-- Only the SHA-256 hash of a verification token is stored. A token verifies
+-- the email it was issued for, so changing the email invalidates it.
+CREATE TABLE email_verification_tokens (
+    token_hash TEXT PRIMARY KEY,
+    account_id TEXT        NOT NULL REFERENCES accounts (id),
+    email      TEXT        NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX email_verification_tokens_account_id_idx ON email_verification_tokens (account_id);
@@ -0,0 +1,9 @@
+-- Only the SHA-256 hash of a password reset token is stored.
+CREATE TABLE password_reset_tokens (
+    token_hash TEXT PRIMARY KEY,
+    account_id TEXT        NOT NULL REFERENCES accounts (id),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX password_reset_tokens_account_id_idx ON password_reset_tokens (account_id);
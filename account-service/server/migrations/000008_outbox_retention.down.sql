@@ -0,0 +1 @@
+DROP INDEX outbox_published_idx;
@@ -0,0 +1,2 @@
+-- Supports deleting published events once they are past retention.
+CREATE INDEX outbox_published_idx ON outbox (published_at) WHERE published_at IS NOT NULL;
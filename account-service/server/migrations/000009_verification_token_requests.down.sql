@@ -0,0 +1 @@
+-- The invalidated tokens cannot be restored.
@@ -0,0 +1,10 @@
+-- account.verification_requested events used to be written to the outbox with
+-- their token in plaintext. The outbox now holds only the account and email,
+-- and the token is issued when the event is published. Tokens issued so far are
+-- invalidated and stripped from the outbox; events not yet published will get
+-- a new token, and owners of the others can request a new link.
+DELETE FROM email_verification_tokens;
+
+UPDATE outbox
+SET payload = jsonb_build_object('account_id', payload ->> 'account_id', 'email', payload ->> 'email')
+WHERE routing_key = 'account.verification_requested';
@@ -0,0 +1,2 @@
+-- The invalidated tokens cannot be restored.
+DROP INDEX IF EXISTS accounts_lower_email_idx;
@@ -0,0 +1,12 @@
+-- account.password_reset_requested events used to be written to the outbox
+-- with their token in plaintext. The outbox now holds only the email, and the
+-- token is issued when the event is published. As with verification tokens in
+-- 000009, tokens issued so far are invalidated and stripped from the outbox.
+DELETE FROM password_reset_tokens;
+
+UPDATE outbox
+SET payload = jsonb_build_object('email', payload ->> 'email')
+WHERE routing_key = 'account.password_reset_requested';
+
+-- Reset requests look accounts up by lower-cased email.
+CREATE INDEX accounts_lower_email_idx ON accounts (lower(email));
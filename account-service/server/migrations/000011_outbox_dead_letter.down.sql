@@ -0,0 +1,7 @@
+DROP INDEX outbox_pending_aggregate_idx;
+DROP INDEX outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox (created_at) WHERE published_at IS NULL;
+
+ALTER TABLE outbox
+    DROP COLUMN dead_lettered_at,
+    DROP COLUMN next_attempt_at;
@@ -0,0 +1,13 @@
+-- Failed events are retried with backoff from next_attempt_at and parked with
+-- dead_lettered_at once they run out of attempts or can never be delivered, so
+-- they no longer hold back other events.
+ALTER TABLE outbox
+    ADD COLUMN next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN dead_lettered_at TIMESTAMPTZ;
+
+DROP INDEX outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox (created_at, id)
+    WHERE published_at IS NULL AND dead_lettered_at IS NULL;
+-- Finds the earlier pending events of an aggregate, which hold back its later ones.
+CREATE INDEX outbox_pending_aggregate_idx ON outbox (aggregate_id, created_at, id)
+    WHERE published_at IS NULL AND dead_lettered_at IS NULL;
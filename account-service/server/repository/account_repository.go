@@ -6,20 +6,63 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/redis/go-redis/v9"
+	"github.com/zuyatna/emoney-microservice/account-service/server/apperr"
 	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// uniqueViolation is the Postgres error code for a unique constraint violation.
+const uniqueViolation = "23505"
+
+var (
+	ErrAccountNotFound = apperr.New(apperr.ErrNotFound, "ACCOUNT_NOT_FOUND", "account not found")
+	ErrEmailTaken      = apperr.New(apperr.ErrAlreadyExists, "EMAIL_ALREADY_REGISTERED", "an account with this email already exists")
+)
+
+// ErrVerificationNotFound is returned for a verification token that is unknown,
+// expired, or was issued for an email the account no longer has.
+var ErrVerificationNotFound = errors.New("email verification not found")
+
+// ErrVerificationNotNeeded is returned when a verification is issued for an
+// email that was verified or replaced since it was requested, or whose account
+// was closed.
+var ErrVerificationNotNeeded = errors.New("email verification no longer needed")
+
+// ErrPasswordResetNotFound is returned for a password reset token that is
+// unknown, expired, already used, or belongs to a closed account.
+var ErrPasswordResetNotFound = errors.New("password reset not found")
+
 type AccountRepository interface {
 	CreateAccount(ctx context.Context, account *domain.Account) error
 	GetAccountByID(ctx context.Context, id string) (*domain.Account, error)
 	GetAccountByEmail(ctx context.Context, email string) (*domain.Account, error)
+	GetPasswordHash(ctx context.Context, id string) (string, error)
+	UpdateAccount(ctx context.Context, id string, name, email *string) (*domain.Account, error)
+	RequestVerification(ctx context.Context, account *domain.Account) error
+	IssueVerification(ctx context.Context, verification *domain.EmailVerification) (*domain.Account, error)
+	VerifyEmail(ctx context.Context, tokenHash string) error
+	UpdatePassword(ctx context.Context, id, password string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	IssuePasswordReset(ctx context.Context, email string, reset *domain.PasswordReset) (*domain.Account, error)
+	ResetPassword(ctx context.Context, tokenHash, password string) (string, error)
+	CloseAccount(ctx context.Context, id string) error
 }
 
+// accountCacheLookups counts account cache lookups by result: hit, miss or
+// error when Redis could not be read.
+var accountCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "account_cache_lookups_total",
+	Help: "Redis account cache lookups in GetAccountByID, by result.",
+}, []string{"result"})
+
 type accountRepository struct {
 	db    *sql.DB
 	redis *redis.Client
@@ -32,6 +75,12 @@ func NewAccountRepository(db *sql.DB, redis *redis.Client) AccountRepository {
 	}
 }
 
+func accountCacheKey(id string) string {
+	return fmt.Sprintf("account:%s", id)
+}
+
+// CreateAccount saves a new account together with its account.created event
+// and a request to verify its email.
 func (r *accountRepository) CreateAccount(ctx context.Context, account *domain.Account) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(account.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -45,37 +94,79 @@ func (r *accountRepository) CreateAccount(ctx context.Context, account *domain.A
 	account.ID = newUUID.String()
 
 	account.Password = string(hashedPassword)
+	if account.Currency == "" {
+		account.Currency = domain.DefaultCurrency
+	}
 	account.CreatedAt = time.Now()
 	account.UpdatedAt = time.Now()
 
-	query := `INSERT INTO accounts (id, name, email, password, balance, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err = r.db.ExecContext(ctx, query, account.ID, account.Name, account.Email, account.Password, account.Balance, account.CreatedAt, account.UpdatedAt)
+	payload, err := json.Marshal(&domain.AccountCreatedEvent{ID: account.ID, Name: account.Name, Email: account.Email})
+	if err != nil {
+		return fmt.Errorf("failed to marshal account created event: %w", err)
+	}
+
+	// The account and its account.created event are committed together, so the
+	// event is never lost when the broker is unavailable.
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	query := `INSERT INTO accounts (id, name, email, password, balance, currency, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = tx.ExecContext(ctx, query, account.ID, account.Name, account.Email, account.Password, account.Balance, account.Currency, account.CreatedAt, account.UpdatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrEmailTaken
+		}
 		return fmt.Errorf("failed to create account: %w", err)
 	}
 
+	if err := insertOutboxEvent(ctx, tx, account.ID, domain.RoutingKeyAccountCreated, payload); err != nil {
+		return err
+	}
+	if err := insertVerificationRequest(ctx, tx, account); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit account: %w", err)
+	}
+
 	return nil
 }
 
+// GetAccountByID returns the account, from the Redis cache when it is there.
+// The account has no Password; GetPasswordHash reads it from Postgres.
 func (r *accountRepository) GetAccountByID(ctx context.Context, id string) (*domain.Account, error) {
 	// Check Redis cache first
-	cacheKey := fmt.Sprintf("account:%s", id)
+	cacheKey := accountCacheKey(id)
 	cachedAccount, err := r.redis.Get(ctx, cacheKey).Result()
-	if err == nil {
+	switch {
+	case err == nil:
 		var account domain.Account
 		if json.Unmarshal([]byte(cachedAccount), &account) == nil {
+			accountCacheLookups.WithLabelValues("hit").Inc()
 			return &account, nil
 		}
+		accountCacheLookups.WithLabelValues("miss").Inc()
+	case errors.Is(err, redis.Nil):
+		accountCacheLookups.WithLabelValues("miss").Inc()
+	default:
+		accountCacheLookups.WithLabelValues("error").Inc()
 	}
 
-	query := `SELECT id, name, email, password, balance, created_at, updated_at FROM accounts WHERE id = ?`
+	query := `SELECT id, name, email, balance, currency, created_at, updated_at, email_verified_at, closed_at FROM accounts WHERE id = $1`
 	row := r.db.QueryRowContext(ctx, query, id)
 
 	account := &domain.Account{}
-	err = row.Scan(&account.ID, &account.Name, &account.Email, &account.Password, &account.Balance, &account.CreatedAt, &account.UpdatedAt)
+	err = row.Scan(&account.ID, &account.Name, &account.Email, &account.Balance, &account.Currency, &account.CreatedAt, &account.UpdatedAt, &account.EmailVerifiedAt, &account.ClosedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("account not found: %w", err)
+			return nil, ErrAccountNotFound
 		}
 		return nil, fmt.Errorf("failed to get account by ID: %w", err)
 	}
@@ -93,17 +184,440 @@ func (r *accountRepository) GetAccountByID(ctx context.Context, id string) (*dom
 }
 
 func (r *accountRepository) GetAccountByEmail(ctx context.Context, email string) (*domain.Account, error) {
-	query := `SELECT id, name, email, password, balance, created_at, updated_at FROM accounts WHERE email = ?`
+	query := `SELECT id, name, email, password, balance, currency, created_at, updated_at, email_verified_at, closed_at FROM accounts WHERE email = $1`
 	row := r.db.QueryRowContext(ctx, query, email)
 
 	account := &domain.Account{}
-	err := row.Scan(&account.ID, &account.Name, &account.Email, &account.Password, &account.Balance, &account.CreatedAt, &account.UpdatedAt)
+	err := row.Scan(&account.ID, &account.Name, &account.Email, &account.Password, &account.Balance, &account.Currency, &account.CreatedAt, &account.UpdatedAt, &account.EmailVerifiedAt, &account.ClosedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("account not found: %w", err)
+			return nil, ErrAccountNotFound
 		}
 		return nil, fmt.Errorf("failed to get account by email: %w", err)
 	}
 
 	return account, nil
 }
+
+// GetPasswordHash returns the bcrypt hash of the account's password.
+func (r *accountRepository) GetPasswordHash(ctx context.Context, id string) (string, error) {
+	var hash string
+	err := r.db.QueryRowContext(ctx, `SELECT password FROM accounts WHERE id = $1`, id).Scan(&hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrAccountNotFound
+		}
+		return "", fmt.Errorf("failed to get password: %w", err)
+	}
+	return hash, nil
+}
+
+// UpdateAccount changes the name and email that are not nil on the open
+// account and returns it. The row is read and locked in the same transaction,
+// and only the columns that change are written, so concurrent updates of other
+// fields are not undone. A new email is unverified and gets a verification
+// request; any change writes an account.updated event. Nothing is written when
+// nothing changes.
+func (r *accountRepository) UpdateAccount(ctx context.Context, id string, name, email *string) (*domain.Account, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	account := &domain.Account{}
+	query := `SELECT id, name, email, balance, currency, created_at, updated_at, email_verified_at FROM accounts WHERE id = $1 AND closed_at IS NULL FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&account.ID, &account.Name, &account.Email, &account.Balance, &account.Currency, &account.CreatedAt, &account.UpdatedAt, &account.EmailVerifiedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("failed to get account by ID: %w", err)
+	}
+
+	var columns []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		columns = append(columns, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if name != nil && *name != account.Name {
+		account.Name = *name
+		set("name", account.Name)
+	}
+	requestVerification := false
+	if email != nil && *email != account.Email {
+		account.Email = *email
+		account.EmailVerifiedAt = nil
+		set("email", account.Email)
+		columns = append(columns, "email_verified_at = NULL")
+		requestVerification = true
+	}
+	if len(columns) == 0 {
+		return account, nil
+	}
+	account.UpdatedAt = time.Now()
+	set("updated_at", account.UpdatedAt)
+
+	args = append(args, account.ID)
+	query = fmt.Sprintf(`UPDATE accounts SET %s WHERE id = $%d`, strings.Join(columns, ", "), len(args))
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("failed to update account: %w", err)
+	}
+
+	payload, err := json.Marshal(accountUpdatedEvent(account))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal account updated event: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, account.ID, domain.RoutingKeyAccountUpdated, payload); err != nil {
+		return nil, err
+	}
+	if requestVerification {
+		if err := insertVerificationRequest(ctx, tx, account); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.commitUncached(ctx, tx, account.ID); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// UpdatePassword replaces the password of an open account and drops the cached
+// copy, whose updated_at it changes.
+func (r *accountRepository) UpdatePassword(ctx context.Context, id, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	query := `UPDATE accounts SET password = $1, updated_at = $2 WHERE id = $3 AND closed_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, string(hashedPassword), time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if err := requireRow(result); err != nil {
+		return err
+	}
+	return r.invalidateCache(ctx, id)
+}
+
+// CloseAccount marks an open account as closed and writes an account.closed
+// event. The cached copy is dropped as in UpdateAccount.
+func (r *accountRepository) CloseAccount(ctx context.Context, id string) error {
+	closedAt := time.Now()
+	payload, err := json.Marshal(&domain.AccountClosedEvent{ID: id, ClosedAt: closedAt})
+	if err != nil {
+		return fmt.Errorf("failed to marshal account closed event: %w", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	query := `UPDATE accounts SET closed_at = $1, updated_at = $1 WHERE id = $2 AND closed_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, closedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to close account: %w", err)
+	}
+	if err := requireRow(result); err != nil {
+		return err
+	}
+
+	if err := insertOutboxEvent(ctx, tx, id, domain.RoutingKeyAccountClosed, payload); err != nil {
+		return err
+	}
+
+	return r.commitUncached(ctx, tx, id)
+}
+
+// RequestVerification requests a new verification of the account's email.
+func (r *accountRepository) RequestVerification(ctx context.Context, account *domain.Account) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if err := insertVerificationRequest(ctx, tx, account); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit email verification: %w", err)
+	}
+	return nil
+}
+
+// IssueVerification stores verification, replacing the account's earlier ones
+// so only the latest token works, provided the account is open and still has
+// the unverified email it was requested for. It returns the account.
+func (r *accountRepository) IssueVerification(ctx context.Context, verification *domain.EmailVerification) (*domain.Account, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	account := &domain.Account{ID: verification.AccountID, Email: verification.Email}
+	query := `SELECT name FROM accounts WHERE id = $1 AND email = $2 AND email_verified_at IS NULL AND closed_at IS NULL FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, account.ID, account.Email).Scan(&account.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrVerificationNotNeeded
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM email_verification_tokens WHERE account_id = $1`, account.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete email verifications: %w", err)
+	}
+	query = `INSERT INTO email_verification_tokens (token_hash, account_id, email, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err = tx.ExecContext(ctx, query, verification.TokenHash, account.ID, account.Email, verification.ExpiresAt, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert email verification: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit email verification: %w", err)
+	}
+	return account, nil
+}
+
+// VerifyEmail marks the email a pending verification was issued for as
+// verified, provided the account still has that email, and writes an
+// account.updated event. The account's pending verifications are removed and
+// the cached copy is dropped as in UpdateAccount.
+func (r *accountRepository) VerifyEmail(ctx context.Context, tokenHash string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	var accountID, email string
+	query := `SELECT account_id, email FROM email_verification_tokens WHERE token_hash = $1 AND expires_at > $2 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(&accountID, &email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrVerificationNotFound
+		}
+		return fmt.Errorf("failed to get email verification: %w", err)
+	}
+
+	account := &domain.Account{ID: accountID, Email: email, UpdatedAt: time.Now()}
+	account.EmailVerifiedAt = &account.UpdatedAt
+	query = `UPDATE accounts SET email_verified_at = $1, updated_at = $1 WHERE id = $2 AND email = $3 AND closed_at IS NULL RETURNING name`
+	err = tx.QueryRowContext(ctx, query, account.UpdatedAt, accountID, email).Scan(&account.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrVerificationNotFound
+		}
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	payload, err := json.Marshal(accountUpdatedEvent(account))
+	if err != nil {
+		return fmt.Errorf("failed to marshal account updated event: %w", err)
+	}
+	if err := insertOutboxEvent(ctx, tx, accountID, domain.RoutingKeyAccountUpdated, payload); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM email_verification_tokens WHERE account_id = $1`, accountID); err != nil {
+		return fmt.Errorf("failed to delete email verifications: %w", err)
+	}
+
+	return r.commitUncached(ctx, tx, accountID)
+}
+
+// RequestPasswordReset writes an account.password_reset_requested event for
+// email without looking the email up, so the call costs the same whether or
+// not it belongs to an account. The outbox relay issues the token, if there is
+// an account to reset, when it publishes the event.
+func (r *accountRepository) RequestPasswordReset(ctx context.Context, email string) error {
+	payload, err := json.Marshal(&domain.TokenRequest{Email: email})
+	if err != nil {
+		return fmt.Errorf("failed to marshal password reset request: %w", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// The account, if any, is not known yet.
+	if err := insertOutboxEvent(ctx, tx, "", domain.RoutingKeyPasswordResetRequested, payload); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit password reset: %w", err)
+	}
+	return nil
+}
+
+// IssuePasswordReset stores reset for the open account with email, replacing
+// the account's earlier resets so only the latest token works, and returns the
+// account. It returns ErrAccountNotFound when there is no such account.
+func (r *accountRepository) IssuePasswordReset(ctx context.Context, email string, reset *domain.PasswordReset) (*domain.Account, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	account := &domain.Account{}
+	// email is already lower-cased. Should two accounts differ only in case,
+	// the older one gets the reset.
+	query := `SELECT id, name, email FROM accounts
+		WHERE lower(email) = $1 AND closed_at IS NULL
+		ORDER BY created_at LIMIT 1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, email).Scan(&account.ID, &account.Name, &account.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("failed to get account by email: %w", err)
+	}
+	reset.AccountID = account.ID
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE account_id = $1`, account.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete password resets: %w", err)
+	}
+	query = `INSERT INTO password_reset_tokens (token_hash, account_id, expires_at, created_at) VALUES ($1, $2, $3, $4)`
+	_, err = tx.ExecContext(ctx, query, reset.TokenHash, reset.AccountID, reset.ExpiresAt, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert password reset: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit password reset: %w", err)
+	}
+	return account, nil
+}
+
+// ResetPassword replaces the password of the open account a pending reset was
+// issued for and returns the account's ID. The account's pending resets are
+// removed, so each token works once. The cached copy is dropped as in
+// UpdatePassword.
+func (r *accountRepository) ResetPassword(ctx context.Context, tokenHash, password string) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	var accountID string
+	query := `SELECT account_id FROM password_reset_tokens WHERE token_hash = $1 AND expires_at > $2 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(&accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrPasswordResetNotFound
+		}
+		return "", fmt.Errorf("failed to get password reset: %w", err)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	query = `UPDATE accounts SET password = $1, updated_at = $2 WHERE id = $3 AND closed_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, string(hashedPassword), time.Now(), accountID)
+	if err != nil {
+		return "", fmt.Errorf("failed to update password: %w", err)
+	}
+	if err := requireRow(result); err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			return "", ErrPasswordResetNotFound
+		}
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE account_id = $1`, accountID); err != nil {
+		return "", fmt.Errorf("failed to delete password resets: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit password reset: %w", err)
+	}
+	return accountID, r.invalidateCache(ctx, accountID)
+}
+
+// insertVerificationRequest writes an account.verification_requested event for
+// the account's current email. It holds no token: the outbox relay issues one
+// when it publishes the event.
+func insertVerificationRequest(ctx context.Context, tx *sql.Tx, account *domain.Account) error {
+	payload, err := json.Marshal(&domain.TokenRequest{AccountID: account.ID, Email: account.Email})
+	if err != nil {
+		return fmt.Errorf("failed to marshal verification request: %w", err)
+	}
+	return insertOutboxEvent(ctx, tx, account.ID, domain.RoutingKeyVerificationRequested, payload)
+}
+
+func accountUpdatedEvent(account *domain.Account) *domain.AccountUpdatedEvent {
+	return &domain.AccountUpdatedEvent{
+		ID:            account.ID,
+		Name:          account.Name,
+		Email:         account.Email,
+		EmailVerified: account.EmailVerifiedAt != nil,
+		UpdatedAt:     account.UpdatedAt,
+	}
+}
+
+// requireRow returns ErrAccountNotFound when an update matched no open account.
+func requireRow(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to count updated accounts: %w", err)
+	}
+	if rows == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+// commitUncached commits tx, which changed account id, with the cached copy of
+// the account dropped first. Should that fail, the change is rolled back rather
+// than hidden behind the cached copy until it expires. A read between the two
+// can cache the old row again, so the copy is dropped once more after the
+// commit; if that fails the error is returned even though the change was
+// saved, and retrying the change is harmless.
+func (r *accountRepository) commitUncached(ctx context.Context, tx *sql.Tx, id string) error {
+	if err := r.invalidateCache(ctx, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit account: %w", err)
+	}
+	return r.invalidateCache(ctx, id)
+}
+
+func (r *accountRepository) invalidateCache(ctx context.Context, id string) error {
+	if err := r.redis.Del(ctx, accountCacheKey(id)).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate cached account: %w", err)
+	}
+	return nil
+}
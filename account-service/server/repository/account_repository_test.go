@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
+)
+
+// accountDB answers the statements of UpdateAccount for an open account named
+// Ana, or as if there were no open account when found is false.
+func accountDB(t *testing.T, found bool) (*fakeDB, *fakeRedis, AccountRepository) {
+	fake, db := newFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.Contains(query, "FOR UPDATE"):
+			result := fakeResult{columns: []string{"id", "name", "email", "balance", "currency", "created_at", "updated_at", "email_verified_at"}}
+			if found {
+				createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+				result.rows = [][]driver.Value{{"acc-a", "Ana", "ana@example.com", int64(5000), "IDR", createdAt, createdAt, createdAt}}
+			}
+			return result
+		default:
+			return fakeResult{affected: 1}
+		}
+	})
+	cache, client := newFakeRedis(t)
+	return fake, cache, NewAccountRepository(db, client)
+}
+
+// routingKeys returns the routing keys of the outbox events that were written.
+func routingKeys(fake *fakeDB) []string {
+	var keys []string
+	for _, s := range fake.find("INSERT INTO outbox") {
+		keys = append(keys, s.args[2].(string))
+	}
+	return keys
+}
+
+func TestUpdateAccount(t *testing.T) {
+	ptr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name         string
+		newName      *string
+		newEmail     *string
+		wantSet      string
+		wantEvents   []string
+		wantVerified bool
+	}{
+		{
+			name:         "name",
+			newName:      ptr("Ana Maria"),
+			wantSet:      "SET name = $1, updated_at = $2 WHERE id = $3",
+			wantEvents:   []string{domain.RoutingKeyAccountUpdated},
+			wantVerified: true,
+		},
+		{
+			name:       "email",
+			newEmail:   ptr("ana.maria@example.com"),
+			wantSet:    "SET email = $1, email_verified_at = NULL, updated_at = $2 WHERE id = $3",
+			wantEvents: []string{domain.RoutingKeyAccountUpdated, domain.RoutingKeyVerificationRequested},
+		},
+		{
+			name:       "name and email",
+			newName:    ptr("Ana Maria"),
+			newEmail:   ptr("ana.maria@example.com"),
+			wantSet:    "SET name = $1, email = $2, email_verified_at = NULL, updated_at = $3 WHERE id = $4",
+			wantEvents: []string{domain.RoutingKeyAccountUpdated, domain.RoutingKeyVerificationRequested},
+		},
+		{
+			name:         "same email, new name",
+			newName:      ptr("Ana Maria"),
+			newEmail:     ptr("ana@example.com"),
+			wantSet:      "SET name = $1, updated_at = $2 WHERE id = $3",
+			wantEvents:   []string{domain.RoutingKeyAccountUpdated},
+			wantVerified: true,
+		},
+		{
+			name:         "nothing changes",
+			newName:      ptr("Ana"),
+			newEmail:     ptr("ana@example.com"),
+			wantVerified: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, cache, repo := accountDB(t, true)
+
+			account, err := repo.UpdateAccount(context.Background(), "acc-a", tt.newName, tt.newEmail)
+			if err != nil {
+				t.Fatalf("UpdateAccount() error = %v", err)
+			}
+
+			if locks := fake.find("FOR UPDATE"); len(locks) != 1 || locks[0].args[0] != "acc-a" {
+				t.Errorf("locked %+v, want the row of acc-a", locks)
+			}
+			if verified := account.EmailVerifiedAt != nil; verified != tt.wantVerified {
+				t.Errorf("email verified = %v, want %v", verified, tt.wantVerified)
+			}
+			if got := routingKeys(fake); !reflect.DeepEqual(got, tt.wantEvents) {
+				t.Errorf("wrote events %v, want %v", got, tt.wantEvents)
+			}
+
+			updates := fake.find("UPDATE accounts")
+			if tt.wantSet == "" {
+				if len(updates) != 0 || fake.committed {
+					t.Errorf("unchanged account was written: %+v", updates)
+				}
+				if len(cache.sent("DEL")) != 0 {
+					t.Errorf("unchanged account was dropped from the cache")
+				}
+				return
+			}
+			if len(updates) != 1 || !strings.HasSuffix(updates[0].query, tt.wantSet) {
+				t.Fatalf("updates = %+v, want one ending in %q", updates, tt.wantSet)
+			}
+			if !fake.committed {
+				t.Error("update was not committed")
+			}
+		})
+	}
+}
+
+func TestUpdateAccountNotOpen(t *testing.T) {
+	fake, _, repo := accountDB(t, false)
+	newName := "Ana Maria"
+
+	_, err := repo.UpdateAccount(context.Background(), "acc-a", &newName, nil)
+	if !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("UpdateAccount() error = %v, want ErrAccountNotFound", err)
+	}
+	if len(fake.find("UPDATE accounts")) != 0 || fake.committed {
+		t.Error("missing account was written")
+	}
+}
+
+func TestUpdateAccountDropsCacheBeforeCommit(t *testing.T) {
+	fake, cache, repo := accountDB(t, true)
+	var committedAtDel []bool
+	cache.onCommand = func(args []string) {
+		if strings.EqualFold(args[0], "DEL") {
+			fake.mu.Lock()
+			committedAtDel = append(committedAtDel, fake.committed)
+			fake.mu.Unlock()
+		}
+	}
+	newName := "Ana Maria"
+
+	if _, err := repo.UpdateAccount(context.Background(), "acc-a", &newName, nil); err != nil {
+		t.Fatalf("UpdateAccount() error = %v", err)
+	}
+
+	// Once so no stale copy outlives the commit, and once more for a copy a
+	// concurrent read may have cached in between.
+	if want := []bool{false, true}; !reflect.DeepEqual(committedAtDel, want) {
+		t.Errorf("cache dropped with committed = %v, want %v", committedAtDel, want)
+	}
+	for _, args := range cache.sent("DEL") {
+		if !reflect.DeepEqual(args, []string{accountCacheKey("acc-a")}) {
+			t.Errorf("DEL %v, want DEL %s", args, accountCacheKey("acc-a"))
+		}
+	}
+}
+
+func TestGetAccountByIDCachesNoPassword(t *testing.T) {
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake, db := newFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{
+			columns: []string{"id", "name", "email", "balance", "currency", "created_at", "updated_at", "email_verified_at", "closed_at"},
+			rows:    [][]driver.Value{{"acc-a", "Ana", "ana@example.com", int64(5000), "IDR", createdAt, createdAt, createdAt, nil}},
+		}
+	})
+	cache, client := newFakeRedis(t)
+	repo := NewAccountRepository(db, client)
+
+	for i := 0; i < 2; i++ {
+		account, err := repo.GetAccountByID(context.Background(), "acc-a")
+		if err != nil {
+			t.Fatalf("GetAccountByID() error = %v", err)
+		}
+		if account.ID != "acc-a" || account.Name != "Ana" || account.EmailVerifiedAt == nil {
+			t.Errorf("read %d = %+v", i+1, account)
+		}
+	}
+
+	reads := fake.find("FROM accounts")
+	if len(reads) != 1 {
+		t.Fatalf("read Postgres %d times, want once and then the cache", len(reads))
+	}
+	if strings.Contains(reads[0].query, "password") {
+		t.Error("GetAccountByID selects the password")
+	}
+	cached, ok := cache.get(accountCacheKey("acc-a"))
+	if !ok {
+		t.Fatal("account was not cached")
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(cached), &fields); err != nil {
+		t.Fatalf("cached account does not decode: %v", err)
+	}
+	if _, ok := fields["password"]; ok {
+		t.Errorf("cached account holds a password: %s", cached)
+	}
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedis is a Redis server that knows GET, SET and DEL, enough for the
+// account cache, so repository code can be tested without Redis. onCommand,
+// when set, is called with each command before it is answered.
+type fakeRedis struct {
+	onCommand func(args []string)
+
+	mu       sync.Mutex
+	values   map[string]string
+	commands [][]string
+}
+
+func newFakeRedis(t *testing.T) (*fakeRedis, *redis.Client) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	fake := &fakeRedis{values: make(map[string]string)}
+	go fake.serve(listener)
+
+	client := redis.NewClient(&redis.Options{
+		Addr:            listener.Addr().String(),
+		Protocol:        2,
+		DisableIdentity: true,
+	})
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = listener.Close()
+	})
+	return fake, client
+}
+
+// sent returns the commands named name that were sent, with their arguments.
+func (f *fakeRedis) sent(name string) [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var found [][]string
+	for _, command := range f.commands {
+		if strings.EqualFold(command[0], name) {
+			found = append(found, command[1:])
+		}
+	}
+	return found
+}
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.values[key]
+	return value, ok
+}
+
+func (f *fakeRedis) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if f.onCommand != nil {
+			f.onCommand(args)
+		}
+		if _, err := io.WriteString(conn, f.answer(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) answer(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, args)
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		f.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.values[key]; ok {
+				delete(f.values, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	n, err := readLength(r, '*')
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readLength(r, '$')
+		if err != nil {
+			return nil, err
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
+
+func readLength(r *bufio.Reader, prefix byte) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 || line[0] != prefix {
+		return 0, fmt.Errorf("unexpected line %q", line)
+	}
+	return strconv.Atoi(line[1:])
+}
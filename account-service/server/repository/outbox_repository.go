@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// outboxRelayLockID is the Postgres advisory lock a relay holds while it
+// processes a batch. It differs from the migration locks of both services.
+const outboxRelayLockID = 4017210003
+
+// Failed events are retried after a delay that doubles with every attempt up
+// to outboxRetryMaxDelay, and dead-lettered after maxOutboxAttempts attempts,
+// about an hour after the first.
+const (
+	maxOutboxAttempts    = 20
+	outboxRetryBaseDelay = "1 second"
+	outboxRetryMaxDelay  = "5 minutes"
+)
+
+type OutboxRepository interface {
+	ProcessPending(ctx context.Context, limit int, publish func(ctx context.Context, event *domain.OutboxEvent) error) (*OutboxBatch, error)
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+// OutboxBatch is what one ProcessPending call did.
+type OutboxBatch struct {
+	// Fetched counts the due events the batch locked, whatever became of them.
+	Fetched   int
+	Published int
+	// DeadLettered are the events parked by the batch, with LastError set.
+	DeadLettered []*domain.OutboxEvent
+}
+
+type outboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, aggregateID, routingKey string, payload []byte) error {
+	newUUID, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("failed to generate UUID: %w", err)
+	}
+
+	traceContext := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, traceContext)
+	traceJSON, err := json.Marshal(traceContext)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trace context: %w", err)
+	}
+
+	query := `INSERT INTO outbox (id, aggregate_id, routing_key, payload, trace_context, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.ExecContext(ctx, query, newUUID.String(), aggregateID, routingKey, string(payload), string(traceJSON), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to insert outbox event: %w", err)
+	}
+	return nil
+}
+
+// ProcessPending locks up to limit due events in creation order and hands them
+// to publish one by one, marking each as sent once publish succeeds. A failed
+// event is retried with backoff, and until it is published or dead-lettered
+// the later events of its aggregate wait behind it; events of other aggregates,
+// and events without one, go ahead. An event is dead-lettered when it fails
+// maxOutboxAttempts times or publish returns domain.ErrEventUndeliverable.
+// Only one relay instance processes a batch at a time, since one taking rows
+// another has locked could publish an aggregate's later events before its
+// earlier ones; the others return an empty batch.
+func (r *outboxRepository) ProcessPending(ctx context.Context, limit int, publish func(ctx context.Context, event *domain.OutboxEvent) error) (*OutboxBatch, error) {
+	batch := &OutboxBatch{}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return batch, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxRelayLockID).Scan(&locked); err != nil {
+		return batch, fmt.Errorf("failed to lock outbox: %w", err)
+	}
+	if !locked {
+		return batch, nil
+	}
+
+	// An event whose aggregate has an earlier event waiting for a retry is
+	// not due yet. Earlier events that are due come first in the batch.
+	query := `SELECT id, aggregate_id, routing_key, payload, trace_context, attempts, created_at
+			  FROM outbox o
+			  WHERE published_at IS NULL AND dead_lettered_at IS NULL AND next_attempt_at <= NOW()
+			    AND (aggregate_id = '' OR NOT EXISTS (
+			        SELECT 1 FROM outbox earlier
+			        WHERE earlier.aggregate_id = o.aggregate_id
+			          AND earlier.published_at IS NULL AND earlier.dead_lettered_at IS NULL
+			          AND earlier.next_attempt_at > NOW()
+			          AND (earlier.created_at, earlier.id) < (o.created_at, o.id)))
+			  ORDER BY created_at, id
+			  LIMIT $1
+			  FOR UPDATE`
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return batch, fmt.Errorf("failed to query outbox: %w", err)
+	}
+
+	var events []*domain.OutboxEvent
+	for rows.Next() {
+		event := &domain.OutboxEvent{}
+		var traceJSON []byte
+		if err := rows.Scan(&event.ID, &event.AggregateID, &event.RoutingKey, &event.Payload, &traceJSON, &event.Attempts, &event.CreatedAt); err != nil {
+			_ = rows.Close()
+			return batch, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		// A malformed trace context only loses the link to the original trace.
+		_ = json.Unmarshal(traceJSON, &event.TraceContext)
+		events = append(events, event)
+	}
+	if err := rows.Close(); err != nil {
+		return batch, fmt.Errorf("failed to close outbox rows: %w", err)
+	}
+	batch.Fetched = len(events)
+
+	// blocked holds the aggregates with an event that failed in this batch.
+	blocked := make(map[string]bool)
+	for _, event := range events {
+		if event.AggregateID != "" && blocked[event.AggregateID] {
+			continue
+		}
+
+		publishErr := publish(ctx, event)
+		if publishErr == nil {
+			_, err := tx.ExecContext(ctx, `UPDATE outbox SET published_at = $1, attempts = attempts + 1, last_error = NULL WHERE id = $2`, time.Now(), event.ID)
+			if err != nil {
+				return batch, fmt.Errorf("failed to mark outbox event as published: %w", err)
+			}
+			batch.Published++
+			continue
+		}
+
+		event.Attempts++
+		event.LastError = publishErr.Error()
+		if event.Attempts >= maxOutboxAttempts || errors.Is(publishErr, domain.ErrEventUndeliverable) {
+			_, err := tx.ExecContext(ctx, `UPDATE outbox SET attempts = $1, last_error = $2, dead_lettered_at = $3 WHERE id = $4`,
+				event.Attempts, event.LastError, time.Now(), event.ID)
+			if err != nil {
+				return batch, fmt.Errorf("failed to dead-letter outbox event: %w", err)
+			}
+			batch.DeadLettered = append(batch.DeadLettered, event)
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, `UPDATE outbox
+			  SET attempts = $1,
+			      last_error = $2,
+			      next_attempt_at = NOW() + LEAST(INTERVAL '`+outboxRetryBaseDelay+`' * POWER(2, attempts), INTERVAL '`+outboxRetryMaxDelay+`')
+			  WHERE id = $3`, event.Attempts, event.LastError, event.ID)
+		if err != nil {
+			return batch, fmt.Errorf("failed to record outbox failure: %w", err)
+		}
+		blocked[event.AggregateID] = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &OutboxBatch{}, fmt.Errorf("failed to commit outbox: %w", err)
+	}
+	return batch, nil
+}
+
+// DeletePublished removes events published before before and returns how many
+// were removed.
+func (r *outboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published outbox events: %w", err)
+	}
+	return result.RowsAffected()
+}
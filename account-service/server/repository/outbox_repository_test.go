@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
+)
+
+// outboxDB answers ProcessPending with events as the due rows, or with no
+// advisory lock when locked is false.
+func outboxDB(t *testing.T, locked bool, events []*domain.OutboxEvent) (*fakeDB, OutboxRepository) {
+	fake, db := newFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.Contains(query, "pg_try_advisory_xact_lock"):
+			return fakeResult{columns: []string{"locked"}, rows: [][]driver.Value{{locked}}}
+		case strings.Contains(query, "FROM outbox o"):
+			result := fakeResult{columns: []string{"id", "aggregate_id", "routing_key", "payload", "trace_context", "attempts", "created_at"}}
+			for _, e := range events {
+				result.rows = append(result.rows, []driver.Value{e.ID, e.AggregateID, e.RoutingKey, e.Payload, []byte("{}"), int64(e.Attempts), e.CreatedAt})
+			}
+			return result
+		default:
+			return fakeResult{affected: 1}
+		}
+	})
+	return fake, NewOutboxRepository(db)
+}
+
+func outboxEvent(id, aggregateID string, attempts int) *domain.OutboxEvent {
+	return &domain.OutboxEvent{
+		ID:          id,
+		AggregateID: aggregateID,
+		RoutingKey:  domain.RoutingKeyAccountUpdated,
+		Payload:     []byte(`{}`),
+		Attempts:    attempts,
+		CreatedAt:   time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+// updatedIDs returns the IDs of the events whose outbox row was updated by a
+// statement containing substr. The ID is always the last argument.
+func updatedIDs(fake *fakeDB, substr string) []string {
+	var ids []string
+	for _, s := range fake.find(substr) {
+		ids = append(ids, s.args[len(s.args)-1].(string))
+	}
+	return ids
+}
+
+func TestProcessPending(t *testing.T) {
+	errBroker := errors.New("broker unavailable")
+
+	tests := []struct {
+		name   string
+		locked bool
+		events []*domain.OutboxEvent
+		// failures maps event IDs to the error publishing them returns.
+		failures         map[string]error
+		wantAttempted    []string
+		wantPublished    []string
+		wantRetried      []string
+		wantDeadLettered []string
+	}{
+		{
+			name:          "all published",
+			locked:        true,
+			events:        []*domain.OutboxEvent{outboxEvent("e1", "acc-a", 0), outboxEvent("e2", "acc-b", 0), outboxEvent("e3", "acc-a", 0)},
+			wantAttempted: []string{"e1", "e2", "e3"},
+			wantPublished: []string{"e1", "e2", "e3"},
+		},
+		{
+			name:          "failure holds back only its aggregate",
+			locked:        true,
+			events:        []*domain.OutboxEvent{outboxEvent("e1", "acc-a", 0), outboxEvent("e2", "acc-b", 0), outboxEvent("e3", "acc-a", 0)},
+			failures:      map[string]error{"e1": errBroker},
+			wantAttempted: []string{"e1", "e2"},
+			wantPublished: []string{"e2"},
+			wantRetried:   []string{"e1"},
+		},
+		{
+			name:          "events without an aggregate are not held back",
+			locked:        true,
+			events:        []*domain.OutboxEvent{outboxEvent("e1", "", 0), outboxEvent("e2", "", 0)},
+			failures:      map[string]error{"e1": errBroker},
+			wantAttempted: []string{"e1", "e2"},
+			wantPublished: []string{"e2"},
+			wantRetried:   []string{"e1"},
+		},
+		{
+			name:             "undeliverable event is dead-lettered at once",
+			locked:           true,
+			events:           []*domain.OutboxEvent{outboxEvent("e1", "acc-a", 0), outboxEvent("e2", "acc-a", 0)},
+			failures:         map[string]error{"e1": fmt.Errorf("bad payload: %w", domain.ErrEventUndeliverable)},
+			wantAttempted:    []string{"e1", "e2"},
+			wantPublished:    []string{"e2"},
+			wantDeadLettered: []string{"e1"},
+		},
+		{
+			name:             "last attempt is dead-lettered",
+			locked:           true,
+			events:           []*domain.OutboxEvent{outboxEvent("e1", "acc-a", maxOutboxAttempts-1), outboxEvent("e2", "acc-a", 0)},
+			failures:         map[string]error{"e1": errBroker},
+			wantAttempted:    []string{"e1", "e2"},
+			wantPublished:    []string{"e2"},
+			wantDeadLettered: []string{"e1"},
+		},
+		{
+			name:   "another relay holds the lock",
+			locked: false,
+			events: []*domain.OutboxEvent{outboxEvent("e1", "acc-a", 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, repo := outboxDB(t, tt.locked, tt.events)
+
+			var attempted []string
+			batch, err := repo.ProcessPending(context.Background(), len(tt.events), func(_ context.Context, event *domain.OutboxEvent) error {
+				attempted = append(attempted, event.ID)
+				return tt.failures[event.ID]
+			})
+			if err != nil {
+				t.Fatalf("ProcessPending() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(attempted, tt.wantAttempted) {
+				t.Errorf("attempted %v, want %v", attempted, tt.wantAttempted)
+			}
+			if got := updatedIDs(fake, "published_at = $1"); !reflect.DeepEqual(got, tt.wantPublished) {
+				t.Errorf("marked %v as published, want %v", got, tt.wantPublished)
+			}
+			if got := updatedIDs(fake, "next_attempt_at = NOW()"); !reflect.DeepEqual(got, tt.wantRetried) {
+				t.Errorf("scheduled %v for a retry, want %v", got, tt.wantRetried)
+			}
+			if got := updatedIDs(fake, "dead_lettered_at = $3"); !reflect.DeepEqual(got, tt.wantDeadLettered) {
+				t.Errorf("dead-lettered %v, want %v", got, tt.wantDeadLettered)
+			}
+
+			if batch.Published != len(tt.wantPublished) {
+				t.Errorf("Published = %d, want %d", batch.Published, len(tt.wantPublished))
+			}
+			var deadLettered []string
+			for _, event := range batch.DeadLettered {
+				deadLettered = append(deadLettered, event.ID)
+				if event.LastError == "" {
+					t.Errorf("dead-lettered event %s has no LastError", event.ID)
+				}
+			}
+			if !reflect.DeepEqual(deadLettered, tt.wantDeadLettered) {
+				t.Errorf("DeadLettered = %v, want %v", deadLettered, tt.wantDeadLettered)
+			}
+			wantFetched := 0
+			if tt.locked {
+				wantFetched = len(tt.events)
+			}
+			if batch.Fetched != wantFetched {
+				t.Errorf("Fetched = %d, want %d", batch.Fetched, wantFetched)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitRepository counts hits per key in fixed windows stored in Redis.
+type RateLimitRepository interface {
+	// Allow records a hit on key and reports whether the key has had at most
+	// limit hits in the current window, which starts with its first hit.
+	Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, error)
+}
+
+type rateLimitRepository struct {
+	redis *redis.Client
+}
+
+func NewRateLimitRepository(redis *redis.Client) RateLimitRepository {
+	return &rateLimitRepository{redis: redis}
+}
+
+func rateLimitKey(key string) string {
+	return fmt.Sprintf("rate_limit:%s", key)
+}
+
+func (r *rateLimitRepository) Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, error) {
+	pipe := r.redis.TxPipeline()
+	hits := pipe.Incr(ctx, rateLimitKey(key))
+	pipe.ExpireNX(ctx, rateLimitKey(key), window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to count rate limited hit: %w", err)
+	}
+	return hits.Val() <= limit, nil
+}
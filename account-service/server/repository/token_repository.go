@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
+)
+
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+// TokenRepository stores hashed refresh tokens in Redis. Every token belongs to
+// a family started at login; revoking the family invalidates all its tokens.
+type TokenRepository interface {
+	SaveRefreshToken(ctx context.Context, token *domain.RefreshToken) error
+	GetRefreshToken(ctx context.Context, hash string) (*domain.RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, token *domain.RefreshToken) (bool, error)
+	IsFamilyActive(ctx context.Context, familyID string) (bool, error)
+	RevokeFamily(ctx context.Context, accountID, familyID string) error
+	RevokeAllFamilies(ctx context.Context, accountID string) error
+	RevokeOtherFamilies(ctx context.Context, accountID, keepFamilyID string) error
+}
+
+type tokenRepository struct {
+	redis *redis.Client
+}
+
+func NewTokenRepository(redis *redis.Client) TokenRepository {
+	return &tokenRepository{redis: redis}
+}
+
+func refreshTokenKey(hash string) string {
+	return fmt.Sprintf("refresh_token:%s", hash)
+}
+
+func refreshTokenUsedKey(hash string) string {
+	return fmt.Sprintf("refresh_token_used:%s", hash)
+}
+
+func refreshFamilyKey(familyID string) string {
+	return fmt.Sprintf("refresh_family:%s", familyID)
+}
+
+func accountFamiliesKey(accountID string) string {
+	return fmt.Sprintf("refresh_families:%s", accountID)
+}
+
+// SaveRefreshToken stores token and keeps its family active until the token expires.
+func (r *tokenRepository) SaveRefreshToken(ctx context.Context, token *domain.RefreshToken) error {
+	tokenJSON, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal refresh token: %w", err)
+	}
+
+	ttl := time.Until(token.ExpiresAt)
+	pipe := r.redis.TxPipeline()
+	pipe.Set(ctx, refreshTokenKey(token.Hash), tokenJSON, ttl)
+	pipe.Set(ctx, refreshFamilyKey(token.FamilyID), token.AccountID, ttl)
+	pipe.SAdd(ctx, accountFamiliesKey(token.AccountID), token.FamilyID)
+	pipe.Expire(ctx, accountFamiliesKey(token.AccountID), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	return nil
+}
+
+func (r *tokenRepository) GetRefreshToken(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	tokenJSON, err := r.redis.Get(ctx, refreshTokenKey(hash)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	token := &domain.RefreshToken{}
+	if err := json.Unmarshal([]byte(tokenJSON), token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal refresh token: %w", err)
+	}
+	token.Hash = hash
+	return token, nil
+}
+
+// MarkRefreshTokenUsed atomically flags token as spent. It returns false when
+// the token had already been used, which indicates a replayed token.
+func (r *tokenRepository) MarkRefreshTokenUsed(ctx context.Context, token *domain.RefreshToken) (bool, error) {
+	marked, err := r.redis.SetNX(ctx, refreshTokenUsedKey(token.Hash), 1, time.Until(token.ExpiresAt)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+	return marked, nil
+}
+
+func (r *tokenRepository) IsFamilyActive(ctx context.Context, familyID string) (bool, error) {
+	exists, err := r.redis.Exists(ctx, refreshFamilyKey(familyID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check refresh token family: %w", err)
+	}
+	return exists == 1, nil
+}
+
+func (r *tokenRepository) RevokeFamily(ctx context.Context, accountID, familyID string) error {
+	pipe := r.redis.TxPipeline()
+	pipe.Del(ctx, refreshFamilyKey(familyID))
+	pipe.SRem(ctx, accountFamiliesKey(accountID), familyID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+func (r *tokenRepository) RevokeAllFamilies(ctx context.Context, accountID string) error {
+	familyIDs, err := r.redis.SMembers(ctx, accountFamiliesKey(accountID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list refresh token families: %w", err)
+	}
+
+	keys := make([]string, 0, len(familyIDs)+1)
+	for _, familyID := range familyIDs {
+		keys = append(keys, refreshFamilyKey(familyID))
+	}
+	keys = append(keys, accountFamiliesKey(accountID))
+	if err := r.redis.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to revoke refresh token families: %w", err)
+	}
+	return nil
+}
+
+// RevokeOtherFamilies revokes every refresh token family of the account except
+// keepFamilyID, signing out all other sessions.
+func (r *tokenRepository) RevokeOtherFamilies(ctx context.Context, accountID, keepFamilyID string) error {
+	familyIDs, err := r.redis.SMembers(ctx, accountFamiliesKey(accountID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list refresh token families: %w", err)
+	}
+
+	pipe := r.redis.TxPipeline()
+	for _, familyID := range familyIDs {
+		if familyID == keepFamilyID {
+			continue
+		}
+		pipe.Del(ctx, refreshFamilyKey(familyID))
+		pipe.SRem(ctx, accountFamiliesKey(accountID), familyID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke refresh token families: %w", err)
+	}
+	return nil
+}
@@ -2,44 +2,112 @@ package usecase
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/zuyatna/emoney-microservice/account-service/server/apperr"
 	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
 	"github.com/zuyatna/emoney-microservice/account-service/server/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrInvalidCredentials  = apperr.New(apperr.ErrInvalidCredentials, "INVALID_CREDENTIALS", "invalid email or password")
+	ErrInvalidRefreshToken = apperr.New(apperr.ErrUnauthenticated, "INVALID_REFRESH_TOKEN", "invalid refresh token")
+	ErrRefreshTokenReused  = apperr.New(apperr.ErrUnauthenticated, "REFRESH_TOKEN_REUSED", "refresh token was already used, log in again")
+	ErrIncorrectPassword   = apperr.New(apperr.ErrPermissionDenied, "INCORRECT_PASSWORD", "password is incorrect")
+	ErrAccountClosed       = apperr.New(apperr.ErrFailedPrecondition, "ACCOUNT_CLOSED", "account is closed")
+
+	ErrInvalidVerificationToken = apperr.New(apperr.ErrInvalidArgument, "INVALID_VERIFICATION_TOKEN", "verification link is invalid or has expired")
+	ErrEmailAlreadyVerified     = apperr.New(apperr.ErrFailedPrecondition, "EMAIL_ALREADY_VERIFIED", "email is already verified")
+
+	ErrInvalidResetToken = apperr.New(apperr.ErrInvalidArgument, "INVALID_RESET_TOKEN", "password reset link is invalid or has expired")
+	ErrTooManyResets     = apperr.New(apperr.ErrRateLimited, "TOO_MANY_PASSWORD_RESETS", "too many password reset requests, try again later")
+)
+
+// Password reset requests are limited per email, so nobody can flood an inbox,
+// and per client IP, so nobody can probe many addresses.
+const (
+	resetsPerEmail = 3
+	resetsPerIP    = 10
+	resetWindow    = time.Hour
+)
+
+var (
+	accountsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "accounts_created_total",
+		Help: "Accounts created.",
+	})
+	accountsClosed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "accounts_closed_total",
+		Help: "Accounts closed.",
+	})
+	logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "account_logins_total",
+		Help: "Login attempts, by result: success, invalid_credentials or account_closed.",
+	}, []string{"result"})
+	passwordResets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "account_password_resets_total",
+		Help: "Password reset requests, by result: requested, rate_limited, unknown_email (dropped when published) or completed.",
+	}, []string{"result"})
+)
+
 type AccountUseCase interface {
 	CreateAccount(ctx context.Context, name, email, password string) (string, error)
-	LoginAccount(ctx context.Context, email, password string) (string, error)
+	LoginAccount(ctx context.Context, email, password string) (*domain.TokenPair, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*domain.TokenPair, error)
+	Logout(ctx context.Context, refreshToken string) error
 	GetAccountByID(ctx context.Context, id string) (*domain.Account, error)
+	UpdateAccount(ctx context.Context, id string, name, email *string) (*domain.Account, error)
+	ChangePassword(ctx context.Context, id, sessionID, currentPassword, newPassword string) error
+	CloseAccount(ctx context.Context, id, password string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, id string) error
+	RequestPasswordReset(ctx context.Context, email, clientIP string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
 }
 
 type accountUseCase struct {
-	repo       repository.AccountRepository
-	publisher  domain.AccountPublisher
-	jwtSecret  []byte
-	jwtExpires time.Duration
+	repo           repository.AccountRepository
+	tokenRepo      repository.TokenRepository
+	rateLimits     repository.RateLimitRepository
+	wallets        domain.WalletService
+	signer         domain.TokenSigner
+	jwtExpires     time.Duration
+	refreshExpires time.Duration
 }
 
-func NewAccountUseCase(repo repository.AccountRepository, publisher domain.AccountPublisher, jwtSecret []byte, jwtExpires time.Duration) AccountUseCase {
+func NewAccountUseCase(repo repository.AccountRepository, tokenRepo repository.TokenRepository, rateLimits repository.RateLimitRepository, wallets domain.WalletService, signer domain.TokenSigner, jwtExpires, refreshExpires time.Duration) AccountUseCase {
 	return &accountUseCase{
-		repo:       repo,
-		publisher:  publisher,
-		jwtSecret:  jwtSecret,
-		jwtExpires: jwtExpires,
+		repo:           repo,
+		tokenRepo:      tokenRepo,
+		rateLimits:     rateLimits,
+		wallets:        wallets,
+		signer:         signer,
+		jwtExpires:     jwtExpires,
+		refreshExpires: refreshExpires,
 	}
 }
 
 func (a *accountUseCase) CreateAccount(ctx context.Context, name string, email string, password string) (string, error) {
-	existing, err := a.repo.GetAccountByEmail(ctx, email)
-	if err != nil {
-		return "", fmt.Errorf("failed to check existing account: %w", err)
+	// The unique index on email is what guarantees uniqueness; this check only
+	// avoids hashing the password of a request that is bound to fail.
+	_, err := a.repo.GetAccountByEmail(ctx, email)
+	if err == nil {
+		return "", repository.ErrEmailTaken
 	}
-	if existing != nil {
-		return "", fmt.Errorf("account with email %s already exists", email)
+	if !errors.Is(err, repository.ErrAccountNotFound) {
+		return "", fmt.Errorf("failed to check existing account: %w", err)
 	}
 
 	account := &domain.Account{
@@ -47,34 +115,136 @@ func (a *accountUseCase) CreateAccount(ctx context.Context, name string, email s
 		Email:    email,
 		Password: password,
 	}
+	// The account.created and account.verification_requested events are written
+	// to the outbox with the account and published by the outbox relay.
 	if err := a.repo.CreateAccount(ctx, account); err != nil {
 		return "", fmt.Errorf("failed to create account: %w", err)
 	}
-
-	// Publish event after successful account creation
-	if err := a.publisher.PublishAccountCreated(ctx, account.ID, account.Name, account.Email); err != nil {
-		return "", fmt.Errorf("failed to publish account created event: %w", err)
-	}
+	accountsCreated.Inc()
 
 	return account.ID, nil
 }
 
-func (a *accountUseCase) LoginAccount(ctx context.Context, email string, password string) (string, error) {
+func (a *accountUseCase) LoginAccount(ctx context.Context, email string, password string) (*domain.TokenPair, error) {
 	account, err := a.repo.GetAccountByEmail(ctx, email)
 	if err != nil {
-		return "", fmt.Errorf("failed to get account by email: %w", err)
-	}
-	if account == nil {
-		return "", fmt.Errorf("invalid credentials")
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			logins.WithLabelValues("invalid_credentials").Inc()
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to get account by email: %w", err)
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password)); err != nil {
-		return "", fmt.Errorf("invalid credentials")
+		logins.WithLabelValues("invalid_credentials").Inc()
+		return nil, ErrInvalidCredentials
+	}
+	if account.ClosedAt != nil {
+		logins.WithLabelValues("account_closed").Inc()
+		return nil, ErrAccountClosed
+	}
+	logins.WithLabelValues("success").Inc()
+
+	// Every login starts a new refresh token family.
+	familyID, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate UUID: %w", err)
+	}
+	return a.issueTokens(ctx, account, familyID.String())
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. Each refresh
+// token can be used once; presenting a spent token means it was stolen or
+// replayed, so the whole family is revoked and the user must log in again.
+func (a *accountUseCase) RefreshToken(ctx context.Context, refreshToken string) (*domain.TokenPair, error) {
+	stored, err := a.tokenRepo.GetRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	fresh, err := a.tokenRepo.MarkRefreshTokenUsed(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		if err := a.tokenRepo.RevokeFamily(ctx, stored.AccountID, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	active, err := a.tokenRepo.IsFamilyActive(ctx, stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	account, err := a.repo.GetAccountByID(ctx, stored.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account by ID: %w", err)
+	}
+	if account.ClosedAt != nil {
+		// Closing revokes every family; this token escaped it, e.g. by being
+		// saved while the account was being closed.
+		if err := a.tokenRepo.RevokeFamily(ctx, stored.AccountID, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrAccountClosed
 	}
+	return a.issueTokens(ctx, account, stored.FamilyID)
+}
 
+// Logout revokes the refresh token family of refreshToken. Unknown tokens are
+// ignored so that logging out twice is harmless.
+func (a *accountUseCase) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := a.tokenRepo.GetRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil
+		}
+		return err
+	}
+	return a.tokenRepo.RevokeFamily(ctx, stored.AccountID, stored.FamilyID)
+}
+
+func (a *accountUseCase) issueTokens(ctx context.Context, account *domain.Account, familyID string) (*domain.TokenPair, error) {
+	accessToken, err := a.signAccessToken(account, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	err = a.tokenRepo.SaveRefreshToken(ctx, &domain.RefreshToken{
+		Hash:      hashToken(refreshToken),
+		AccountID: account.ID,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(a.refreshExpires),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    a.jwtExpires,
+	}, nil
+}
+
+func (a *accountUseCase) signAccessToken(account *domain.Account, familyID string) (string, error) {
 	claims := &domain.CustomClaim{
-		ID:    account.ID,
-		Email: account.Email,
+		ID:        account.ID,
+		Email:     account.Email,
+		SessionID: familyID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(a.jwtExpires)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -82,8 +252,7 @@ func (a *accountUseCase) LoginAccount(ctx context.Context, email string, passwor
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(a.jwtSecret)
+	tokenString, err := a.signer.Sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign JWT token: %w", err)
 	}
@@ -91,6 +260,182 @@ func (a *accountUseCase) LoginAccount(ctx context.Context, email string, passwor
 	return tokenString, nil
 }
 
+// newToken returns a random URL-safe token with 256 bits of entropy.
+func newToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func (a *accountUseCase) GetAccountByID(ctx context.Context, id string) (*domain.Account, error) {
 	return a.repo.GetAccountByID(ctx, id)
 }
+
+// UpdateAccount changes the name and email that are not nil. The account.updated
+// event is written to the outbox with the change. A new email is unverified
+// until the owner follows the link sent to it.
+func (a *accountUseCase) UpdateAccount(ctx context.Context, id string, name, email *string) (*domain.Account, error) {
+	if _, err := a.openAccount(ctx, id); err != nil {
+		return nil, err
+	}
+
+	account, err := a.repo.UpdateAccount(ctx, id, name, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update account: %w", err)
+	}
+	return account, nil
+}
+
+// ChangePassword replaces the password after checking the current one, then
+// revokes every session but sessionID. account-service stops accepting their
+// access tokens at once; transaction-service, which cannot see sessions, until
+// they expire.
+func (a *accountUseCase) ChangePassword(ctx context.Context, id, sessionID, currentPassword, newPassword string) error {
+	if _, err := a.openAccount(ctx, id); err != nil {
+		return err
+	}
+	if err := a.checkPassword(ctx, id, currentPassword); err != nil {
+		return err
+	}
+
+	if err := a.repo.UpdatePassword(ctx, id, newPassword); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return a.tokenRepo.RevokeOtherFamilies(ctx, id, sessionID)
+}
+
+// CloseAccount closes the wallet in transaction-service, which refuses unless
+// the balance is zero and from then on rejects topups and transfers, and then
+// the account itself, signing out every session. If closing the account fails
+// after the wallet was closed, calling CloseAccount again completes it.
+func (a *accountUseCase) CloseAccount(ctx context.Context, id, password string) error {
+	if _, err := a.openAccount(ctx, id); err != nil {
+		return err
+	}
+	if err := a.checkPassword(ctx, id, password); err != nil {
+		return err
+	}
+
+	if err := a.wallets.CloseWallet(ctx, id); err != nil {
+		return fmt.Errorf("failed to close wallet: %w", err)
+	}
+	if err := a.repo.CloseAccount(ctx, id); err != nil {
+		return fmt.Errorf("failed to close account: %w", err)
+	}
+	accountsClosed.Inc()
+
+	return a.tokenRepo.RevokeAllFamilies(ctx, id)
+}
+
+// checkPassword compares password with the account's stored hash, which the
+// cached account does not hold.
+func (a *accountUseCase) checkPassword(ctx context.Context, id, password string) error {
+	hash, err := a.repo.GetPasswordHash(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrIncorrectPassword
+	}
+	return nil
+}
+
+func (a *accountUseCase) openAccount(ctx context.Context, id string) (*domain.Account, error) {
+	account, err := a.repo.GetAccountByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if account.ClosedAt != nil {
+		return nil, ErrAccountClosed
+	}
+	return account, nil
+}
+
+// VerifyEmail marks the email the token was sent to as verified. Each token
+// works once and only while the account still has that email.
+func (a *accountUseCase) VerifyEmail(ctx context.Context, token string) error {
+	if err := a.repo.VerifyEmail(ctx, hashToken(token)); err != nil {
+		if errors.Is(err, repository.ErrVerificationNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	return nil
+}
+
+// ResendVerification sends a new verification link to the account's email,
+// invalidating the links sent before.
+func (a *accountUseCase) ResendVerification(ctx context.Context, id string) error {
+	account, err := a.openAccount(ctx, id)
+	if err != nil {
+		return err
+	}
+	if account.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	if err := a.repo.RequestVerification(ctx, account); err != nil {
+		return fmt.Errorf("failed to request email verification: %w", err)
+	}
+	return nil
+}
+
+// RequestPasswordReset asks for a password reset link to be sent to email if
+// it belongs to an open account. Whether it does is only checked when the
+// request is published, so the call does the same work, and gives the same
+// answer, either way; only the rate limits make it fail. The client IP is
+// checked first so that a client over its limit cannot use up the limit of
+// the email it targets. Emails are matched without regard to case.
+func (a *accountUseCase) RequestPasswordReset(ctx context.Context, email, clientIP string) error {
+	// The same normalised email is rate limited and looked up, so variants in
+	// case share a limit and still find the account.
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	allowed := true
+	var err error
+	if clientIP != "" {
+		allowed, err = a.rateLimits.Allow(ctx, "password_reset:ip:"+clientIP, resetsPerIP, resetWindow)
+		if err != nil {
+			return err
+		}
+	}
+	if allowed {
+		allowed, err = a.rateLimits.Allow(ctx, "password_reset:email:"+hashToken(email), resetsPerEmail, resetWindow)
+		if err != nil {
+			return err
+		}
+	}
+	if !allowed {
+		passwordResets.WithLabelValues("rate_limited").Inc()
+		return ErrTooManyResets
+	}
+
+	if err := a.repo.RequestPasswordReset(ctx, email); err != nil {
+		return fmt.Errorf("failed to request password reset: %w", err)
+	}
+	passwordResets.WithLabelValues("requested").Inc()
+	return nil
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset and
+// signs out every session, since whoever knew the old password may be among
+// them. Their access tokens are treated as in ChangePassword.
+func (a *accountUseCase) ResetPassword(ctx context.Context, token, newPassword string) error {
+	accountID, err := a.repo.ResetPassword(ctx, hashToken(token), newPassword)
+	if err != nil {
+		if errors.Is(err, repository.ErrPasswordResetNotFound) {
+			return ErrInvalidResetToken
+		}
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+	passwordResets.WithLabelValues("completed").Inc()
+
+	return a.tokenRepo.RevokeAllFamilies(ctx, accountID)
+}
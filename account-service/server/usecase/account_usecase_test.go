@@ -0,0 +1,336 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
+	"github.com/zuyatna/emoney-microservice/account-service/server/repository"
+)
+
+// fakeRateLimits counts hits per key in memory, with a window that never ends.
+type fakeRateLimits struct {
+	hits map[string]int64
+	keys []string
+}
+
+func (f *fakeRateLimits) Allow(_ context.Context, key string, limit int64, _ time.Duration) (bool, error) {
+	if f.hits == nil {
+		f.hits = make(map[string]int64)
+	}
+	f.keys = append(f.keys, key)
+	f.hits[key]++
+	return f.hits[key] <= limit, nil
+}
+
+type resetRequest struct {
+	email    string
+	clientIP string
+}
+
+func TestRequestPasswordResetLimits(t *testing.T) {
+	repeat := func(n int, request func(i int) resetRequest) []resetRequest {
+		requests := make([]resetRequest, n)
+		for i := range requests {
+			requests[i] = request(i)
+		}
+		return requests
+	}
+
+	tests := []struct {
+		name     string
+		requests []resetRequest
+		// wantAllowed is how many of the requests succeed, all before the
+		// first that is refused.
+		wantAllowed int
+	}{
+		{
+			name: "per email",
+			requests: repeat(resetsPerEmail+1, func(i int) resetRequest {
+				return resetRequest{email: "ana@example.com", clientIP: fmt.Sprintf("203.0.113.%d", i)}
+			}),
+			wantAllowed: resetsPerEmail,
+		},
+		{
+			name: "per email regardless of case and spaces",
+			requests: []resetRequest{
+				{email: "ana@example.com", clientIP: "203.0.113.1"},
+				{email: "Ana@Example.com", clientIP: "203.0.113.2"},
+				{email: " ANA@EXAMPLE.COM ", clientIP: "203.0.113.3"},
+				{email: "ana@EXAMPLE.com", clientIP: "203.0.113.4"},
+			},
+			wantAllowed: resetsPerEmail,
+		},
+		{
+			name: "per client IP",
+			requests: repeat(resetsPerIP+1, func(i int) resetRequest {
+				return resetRequest{email: fmt.Sprintf("user%d@example.com", i), clientIP: "203.0.113.1"}
+			}),
+			wantAllowed: resetsPerIP,
+		},
+		{
+			name: "without a client IP only per email",
+			requests: repeat(resetsPerIP+1, func(i int) resetRequest {
+				return resetRequest{email: fmt.Sprintf("user%d@example.com", i)}
+			}),
+			wantAllowed: resetsPerIP + 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAccountRepository{}
+			uc := &accountUseCase{repo: repo, rateLimits: &fakeRateLimits{}}
+
+			for i, r := range tt.requests {
+				err := uc.RequestPasswordReset(context.Background(), r.email, r.clientIP)
+				if i < tt.wantAllowed && err != nil {
+					t.Fatalf("request %d: error = %v", i+1, err)
+				}
+				if i >= tt.wantAllowed && !errors.Is(err, ErrTooManyResets) {
+					t.Fatalf("request %d: error = %v, want ErrTooManyResets", i+1, err)
+				}
+			}
+			if len(repo.resetEmails) != tt.wantAllowed {
+				t.Errorf("%d requests were written, want %d", len(repo.resetEmails), tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestRequestPasswordResetNormalisesEmail(t *testing.T) {
+	repo := &fakeAccountRepository{}
+	limits := &fakeRateLimits{}
+	uc := &accountUseCase{repo: repo, rateLimits: limits}
+
+	if err := uc.RequestPasswordReset(context.Background(), "  Ana@Example.COM ", "203.0.113.1"); err != nil {
+		t.Fatalf("RequestPasswordReset() error = %v", err)
+	}
+
+	// The email that is rate limited is the one that is looked up.
+	const want = "ana@example.com"
+	if len(repo.resetEmails) != 1 || repo.resetEmails[0] != want {
+		t.Errorf("requested resets for %q, want [%q]", repo.resetEmails, want)
+	}
+	wantKeys := []string{"password_reset:ip:203.0.113.1", "password_reset:email:" + hashToken(want)}
+	if fmt.Sprint(limits.keys) != fmt.Sprint(wantKeys) {
+		t.Errorf("rate limited %v, want %v", limits.keys, wantKeys)
+	}
+}
+
+func TestRequestPasswordResetChecksClientIPFirst(t *testing.T) {
+	limits := &fakeRateLimits{hits: map[string]int64{"password_reset:ip:203.0.113.1": resetsPerIP}}
+	uc := &accountUseCase{repo: &fakeAccountRepository{}, rateLimits: limits}
+
+	err := uc.RequestPasswordReset(context.Background(), "ana@example.com", "203.0.113.1")
+	if !errors.Is(err, ErrTooManyResets) {
+		t.Fatalf("RequestPasswordReset() error = %v, want ErrTooManyResets", err)
+	}
+	// A client over its own limit does not use up the limit of the email it targets.
+	if hits := limits.hits["password_reset:email:"+hashToken("ana@example.com")]; hits != 0 {
+		t.Errorf("email limit counted %d hits, want 0", hits)
+	}
+}
+
+// fakeTokenRepository keeps refresh tokens and their families in memory, as
+// the Redis repository does.
+type fakeTokenRepository struct {
+	tokens map[string]*domain.RefreshToken
+	used   map[string]bool
+	// families maps active family IDs to their account.
+	families map[string]string
+}
+
+func newFakeTokenRepository() *fakeTokenRepository {
+	return &fakeTokenRepository{
+		tokens:   make(map[string]*domain.RefreshToken),
+		used:     make(map[string]bool),
+		families: make(map[string]string),
+	}
+}
+
+func (f *fakeTokenRepository) SaveRefreshToken(_ context.Context, token *domain.RefreshToken) error {
+	stored := *token
+	f.tokens[token.Hash] = &stored
+	f.families[token.FamilyID] = token.AccountID
+	return nil
+}
+
+func (f *fakeTokenRepository) GetRefreshToken(_ context.Context, hash string) (*domain.RefreshToken, error) {
+	token, ok := f.tokens[hash]
+	if !ok {
+		return nil, repository.ErrRefreshTokenNotFound
+	}
+	stored := *token
+	return &stored, nil
+}
+
+func (f *fakeTokenRepository) MarkRefreshTokenUsed(_ context.Context, token *domain.RefreshToken) (bool, error) {
+	if f.used[token.Hash] {
+		return false, nil
+	}
+	f.used[token.Hash] = true
+	return true, nil
+}
+
+func (f *fakeTokenRepository) IsFamilyActive(_ context.Context, familyID string) (bool, error) {
+	_, ok := f.families[familyID]
+	return ok, nil
+}
+
+func (f *fakeTokenRepository) RevokeFamily(_ context.Context, _, familyID string) error {
+	delete(f.families, familyID)
+	return nil
+}
+
+func (f *fakeTokenRepository) RevokeAllFamilies(_ context.Context, accountID string) error {
+	return f.RevokeOtherFamilies(context.Background(), accountID, "")
+}
+
+func (f *fakeTokenRepository) RevokeOtherFamilies(_ context.Context, accountID, keepFamilyID string) error {
+	for familyID, owner := range f.families {
+		if owner == accountID && familyID != keepFamilyID {
+			delete(f.families, familyID)
+		}
+	}
+	return nil
+}
+
+// fakeSigner "signs" claims as the session they were issued for.
+type fakeSigner struct{}
+
+func (fakeSigner) Sign(claims jwt.Claims) (string, error) {
+	return "access:" + claims.(*domain.CustomClaim).SessionID, nil
+}
+
+func newTokenUseCase(account *domain.Account, tokens *fakeTokenRepository) *accountUseCase {
+	return &accountUseCase{
+		repo:           &fakeAccountRepository{account: account},
+		tokenRepo:      tokens,
+		signer:         fakeSigner{},
+		jwtExpires:     15 * time.Minute,
+		refreshExpires: 24 * time.Hour,
+	}
+}
+
+// login starts a refresh token family for account the way LoginAccount does.
+func login(t *testing.T, uc *accountUseCase, account *domain.Account, familyID string) *domain.TokenPair {
+	t.Helper()
+	pair, err := uc.issueTokens(context.Background(), account, familyID)
+	if err != nil {
+		t.Fatalf("issueTokens() error = %v", err)
+	}
+	return pair
+}
+
+func TestRefreshTokenRotates(t *testing.T) {
+	account := &domain.Account{ID: "acc-a", Email: "ana@example.com"}
+	tokens := newFakeTokenRepository()
+	uc := newTokenUseCase(account, tokens)
+	first := login(t, uc, account, "family-1")
+
+	second, err := uc.RefreshToken(context.Background(), first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("refresh token was not rotated")
+	}
+	if second.AccessToken != "access:family-1" {
+		t.Errorf("access token = %q, want one for the same session", second.AccessToken)
+	}
+	stored, ok := tokens.tokens[hashToken(second.RefreshToken)]
+	if !ok {
+		t.Fatal("rotated token was not stored by its hash")
+	}
+	if stored.FamilyID != "family-1" || stored.AccountID != account.ID {
+		t.Errorf("stored %+v, want it in family-1 of %s", stored, account.ID)
+	}
+	if _, ok := tokens.tokens[second.RefreshToken]; ok {
+		t.Error("refresh token was stored in the clear")
+	}
+
+	if _, err := uc.RefreshToken(context.Background(), second.RefreshToken); err != nil {
+		t.Fatalf("RefreshToken() with the rotated token error = %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	account := &domain.Account{ID: "acc-a", Email: "ana@example.com"}
+	tokens := newFakeTokenRepository()
+	uc := newTokenUseCase(account, tokens)
+	stolen := login(t, uc, account, "family-1")
+	otherDevice := login(t, uc, account, "family-2")
+
+	rotated, err := uc.RefreshToken(context.Background(), stolen.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	if _, err := uc.RefreshToken(context.Background(), stolen.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("RefreshToken() with a spent token error = %v, want ErrRefreshTokenReused", err)
+	}
+	// The whole family is revoked, including the token the spent one was
+	// rotated into, but not the account's other sessions.
+	if _, err := uc.RefreshToken(context.Background(), rotated.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("RefreshToken() in the revoked family error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := uc.RefreshToken(context.Background(), otherDevice.RefreshToken); err != nil {
+		t.Errorf("RefreshToken() in another family error = %v", err)
+	}
+}
+
+func TestRefreshTokenRejects(t *testing.T) {
+	closedAt := time.Now()
+	tests := []struct {
+		name    string
+		account *domain.Account
+		token   func(uc *accountUseCase, account *domain.Account) string
+		wantErr error
+	}{
+		{
+			name:    "unknown token",
+			account: &domain.Account{ID: "acc-a"},
+			token:   func(*accountUseCase, *domain.Account) string { return "not-a-token" },
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name:    "logged out",
+			account: &domain.Account{ID: "acc-a"},
+			token: func(uc *accountUseCase, account *domain.Account) string {
+				pair, _ := uc.issueTokens(context.Background(), account, "family-1")
+				_ = uc.Logout(context.Background(), pair.RefreshToken)
+				return pair.RefreshToken
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name:    "closed account",
+			account: &domain.Account{ID: "acc-a", ClosedAt: &closedAt},
+			token: func(uc *accountUseCase, account *domain.Account) string {
+				pair, _ := uc.issueTokens(context.Background(), account, "family-1")
+				return pair.RefreshToken
+			},
+			wantErr: ErrAccountClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := newFakeTokenRepository()
+			uc := newTokenUseCase(tt.account, tokens)
+
+			_, err := uc.RefreshToken(context.Background(), tt.token(uc, tt.account))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RefreshToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(tokens.families) != 0 {
+				t.Errorf("families %v are still active", tokens.families)
+			}
+		})
+	}
+}
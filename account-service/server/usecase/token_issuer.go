@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
+	"github.com/zuyatna/emoney-microservice/account-service/server/repository"
+)
+
+// TokenIssuer issues the one-time tokens that account.verification_requested
+// and account.password_reset_requested events carry to the mailer. The outbox
+// only holds a domain.TokenRequest; the token is issued as the event is
+// published and only its hash is stored, so a plaintext token never reaches
+// the database.
+type TokenIssuer interface {
+	// Issue returns the payload to publish for event, or false when the event
+	// no longer applies and is dropped. Events without a token are returned as
+	// they are. A request that can never be issued fails with
+	// domain.ErrEventUndeliverable.
+	Issue(ctx context.Context, event *domain.OutboxEvent) ([]byte, bool, error)
+}
+
+type tokenIssuer struct {
+	repo repository.AccountRepository
+	// verificationExpires is how long an email verification token is valid.
+	verificationExpires time.Duration
+	// resetExpires is how long a password reset token is valid.
+	resetExpires time.Duration
+}
+
+func NewTokenIssuer(repo repository.AccountRepository, verificationExpires, resetExpires time.Duration) TokenIssuer {
+	return &tokenIssuer{
+		repo:                repo,
+		verificationExpires: verificationExpires,
+		resetExpires:        resetExpires,
+	}
+}
+
+func (t *tokenIssuer) Issue(ctx context.Context, event *domain.OutboxEvent) ([]byte, bool, error) {
+	if event.RoutingKey != domain.RoutingKeyVerificationRequested && event.RoutingKey != domain.RoutingKeyPasswordResetRequested {
+		return event.Payload, true, nil
+	}
+
+	// No retry can decode a malformed request, so it is dead-lettered rather
+	// than left to hold back the events behind it.
+	var request domain.TokenRequest
+	if err := json.Unmarshal(event.Payload, &request); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal token request: %w: %w", err, domain.ErrEventUndeliverable)
+	}
+	if event.RoutingKey == domain.RoutingKeyPasswordResetRequested {
+		return t.issuePasswordReset(ctx, &request)
+	}
+	return t.issueVerification(ctx, &request)
+}
+
+func (t *tokenIssuer) issueVerification(ctx context.Context, request *domain.TokenRequest) ([]byte, bool, error) {
+	if request.AccountID == "" || request.Email == "" {
+		return nil, false, fmt.Errorf("verification request lacks an account or email: %w", domain.ErrEventUndeliverable)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	verification := &domain.EmailVerification{
+		Token:     token,
+		TokenHash: hashToken(token),
+		AccountID: request.AccountID,
+		Email:     request.Email,
+		ExpiresAt: time.Now().Add(t.verificationExpires),
+	}
+
+	account, err := t.repo.IssueVerification(ctx, verification)
+	if err != nil {
+		if errors.Is(err, repository.ErrVerificationNotNeeded) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	payload, err := json.Marshal(&domain.VerificationRequestedEvent{
+		AccountID: account.ID,
+		Name:      account.Name,
+		Email:     account.Email,
+		Token:     verification.Token,
+		ExpiresAt: verification.ExpiresAt,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal verification requested event: %w", err)
+	}
+	return payload, true, nil
+}
+
+// issuePasswordReset drops requests for emails that do not belong to an open
+// account, which RequestPasswordReset deliberately did not check.
+func (t *tokenIssuer) issuePasswordReset(ctx context.Context, request *domain.TokenRequest) ([]byte, bool, error) {
+	if request.Email == "" {
+		return nil, false, fmt.Errorf("password reset request lacks an email: %w", domain.ErrEventUndeliverable)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate password reset token: %w", err)
+	}
+	reset := &domain.PasswordReset{
+		Token:     token,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(t.resetExpires),
+	}
+
+	account, err := t.repo.IssuePasswordReset(ctx, request.Email, reset)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			passwordResets.WithLabelValues("unknown_email").Inc()
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	payload, err := json.Marshal(&domain.PasswordResetRequestedEvent{
+		AccountID: account.ID,
+		Name:      account.Name,
+		Email:     account.Email,
+		Token:     reset.Token,
+		ExpiresAt: reset.ExpiresAt,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal password reset requested event: %w", err)
+	}
+	return payload, true, nil
+}
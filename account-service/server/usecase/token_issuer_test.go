@@ -0,0 +1,191 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/account-service/server/domain"
+	"github.com/zuyatna/emoney-microservice/account-service/server/repository"
+)
+
+// fakeAccountRepository records what the token issuer stores. Methods the
+// tests do not use panic through the embedded nil interface.
+type fakeAccountRepository struct {
+	repository.AccountRepository
+	account *domain.Account
+	err     error
+
+	verifications []*domain.EmailVerification
+	resetEmails   []string
+	resets        []*domain.PasswordReset
+}
+
+func (f *fakeAccountRepository) GetAccountByID(_ context.Context, id string) (*domain.Account, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.account == nil || f.account.ID != id {
+		return nil, repository.ErrAccountNotFound
+	}
+	return f.account, nil
+}
+
+func (f *fakeAccountRepository) IssueVerification(_ context.Context, verification *domain.EmailVerification) (*domain.Account, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.verifications = append(f.verifications, verification)
+	return f.account, nil
+}
+
+func (f *fakeAccountRepository) IssuePasswordReset(_ context.Context, email string, reset *domain.PasswordReset) (*domain.Account, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.resetEmails = append(f.resetEmails, email)
+	f.resets = append(f.resets, reset)
+	return f.account, nil
+}
+
+func (f *fakeAccountRepository) RequestPasswordReset(_ context.Context, email string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.resetEmails = append(f.resetEmails, email)
+	return nil
+}
+
+func TestIssueVerification(t *testing.T) {
+	account := &domain.Account{ID: "acc-a", Name: "Ana", Email: "ana@example.com"}
+	errDatabase := errors.New("connection refused")
+
+	tests := []struct {
+		name              string
+		payload           string
+		repoErr           error
+		wantPublish       bool
+		wantUndeliverable bool
+		wantErr           error
+	}{
+		{name: "issued", payload: `{"account_id":"acc-a","email":"ana@example.com"}`, wantPublish: true},
+		{name: "no longer needed", payload: `{"account_id":"acc-a","email":"ana@example.com"}`, repoErr: repository.ErrVerificationNotNeeded},
+		{name: "database failure is retried", payload: `{"account_id":"acc-a","email":"ana@example.com"}`, repoErr: errDatabase, wantErr: errDatabase},
+		{name: "malformed payload", payload: `{"account_id":`, wantUndeliverable: true},
+		{name: "not an object", payload: `"acc-a"`, wantUndeliverable: true},
+		{name: "missing account", payload: `{"email":"ana@example.com"}`, wantUndeliverable: true},
+		{name: "missing email", payload: `{"account_id":"acc-a"}`, wantUndeliverable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAccountRepository{account: account, err: tt.repoErr}
+			issuer := NewTokenIssuer(repo, time.Hour, time.Hour)
+			event := &domain.OutboxEvent{ID: "e1", RoutingKey: domain.RoutingKeyVerificationRequested, Payload: []byte(tt.payload)}
+
+			payload, publish, err := issuer.Issue(context.Background(), event)
+			if got := errors.Is(err, domain.ErrEventUndeliverable); got != tt.wantUndeliverable {
+				t.Fatalf("Issue() error = %v, undeliverable %v, want %v", err, got, tt.wantUndeliverable)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Issue() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !tt.wantUndeliverable && err != nil {
+				t.Fatalf("Issue() error = %v", err)
+			}
+			if publish != tt.wantPublish {
+				t.Fatalf("Issue() publish = %v, want %v", publish, tt.wantPublish)
+			}
+			if !publish {
+				return
+			}
+
+			var published domain.VerificationRequestedEvent
+			if err := json.Unmarshal(payload, &published); err != nil {
+				t.Fatalf("published payload does not decode: %v", err)
+			}
+			if published.AccountID != account.ID || published.Email != account.Email || published.Token == "" {
+				t.Errorf("published %+v", published)
+			}
+			if len(repo.verifications) != 1 {
+				t.Fatalf("stored %d verifications, want 1", len(repo.verifications))
+			}
+			if stored := repo.verifications[0]; stored.TokenHash != hashToken(published.Token) {
+				t.Errorf("stored hash %q does not match the published token", stored.TokenHash)
+			}
+		})
+	}
+}
+
+func TestIssuePassesOtherEventsThrough(t *testing.T) {
+	issuer := NewTokenIssuer(&fakeAccountRepository{}, time.Hour, time.Hour)
+	event := &domain.OutboxEvent{ID: "e1", RoutingKey: domain.RoutingKeyAccountUpdated, Payload: []byte(`not json`)}
+
+	payload, publish, err := issuer.Issue(context.Background(), event)
+	if err != nil || !publish || string(payload) != "not json" {
+		t.Errorf("Issue() = %q, %v, %v, want the payload unchanged", payload, publish, err)
+	}
+}
+
+func TestIssuePasswordReset(t *testing.T) {
+	account := &domain.Account{ID: "acc-a", Name: "Ana", Email: "Ana@example.com"}
+	errDatabase := errors.New("connection refused")
+
+	tests := []struct {
+		name              string
+		payload           string
+		repoErr           error
+		wantPublish       bool
+		wantUndeliverable bool
+		wantErr           error
+	}{
+		{name: "issued", payload: `{"email":"ana@example.com"}`, wantPublish: true},
+		{name: "unknown email is dropped", payload: `{"email":"ana@example.com"}`, repoErr: repository.ErrAccountNotFound},
+		{name: "database failure is retried", payload: `{"email":"ana@example.com"}`, repoErr: errDatabase, wantErr: errDatabase},
+		{name: "malformed payload", payload: `{"email"`, wantUndeliverable: true},
+		{name: "missing email", payload: `{}`, wantUndeliverable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAccountRepository{account: account, err: tt.repoErr}
+			issuer := NewTokenIssuer(repo, time.Hour, 30*time.Minute)
+			event := &domain.OutboxEvent{ID: "e1", RoutingKey: domain.RoutingKeyPasswordResetRequested, Payload: []byte(tt.payload)}
+
+			before := time.Now()
+			payload, publish, err := issuer.Issue(context.Background(), event)
+			if got := errors.Is(err, domain.ErrEventUndeliverable); got != tt.wantUndeliverable {
+				t.Fatalf("Issue() error = %v, undeliverable %v, want %v", err, got, tt.wantUndeliverable)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Issue() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !tt.wantUndeliverable && err != nil {
+				t.Fatalf("Issue() error = %v", err)
+			}
+			if publish != tt.wantPublish {
+				t.Fatalf("Issue() publish = %v, want %v", publish, tt.wantPublish)
+			}
+			if !publish {
+				return
+			}
+
+			var published domain.PasswordResetRequestedEvent
+			if err := json.Unmarshal(payload, &published); err != nil {
+				t.Fatalf("published payload does not decode: %v", err)
+			}
+			// The event goes to the address on the account, not the one typed in.
+			if published.AccountID != account.ID || published.Email != account.Email || published.Token == "" {
+				t.Errorf("published %+v", published)
+			}
+			if published.ExpiresAt.Before(before.Add(30*time.Minute)) || published.ExpiresAt.After(time.Now().Add(30*time.Minute)) {
+				t.Errorf("ExpiresAt = %v, want 30 minutes from now", published.ExpiresAt)
+			}
+			if len(repo.resets) != 1 || repo.resets[0].TokenHash != hashToken(published.Token) {
+				t.Errorf("stored resets %+v do not match the published token", repo.resets)
+			}
+		})
+	}
+}
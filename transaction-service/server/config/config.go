@@ -3,16 +3,28 @@ package config
 import (
 	"errors"
 	"github.com/spf13/viper"
+	"time"
 )
 
 type Config struct {
-	GRPCPort             string `mapstructure:"GRPC_PORT"`
-	HTTPPort             string `mapstructure:"HTTP_PORT"`
-	PostgresURL          string `mapstructure:"POSTGRES_URL"`
-	ElasticsearchURL     string `mapstructure:"ELASTICSEARCH_URL"`
-	JWTSecret            string `mapstructure:"JWT_SECRET"`
-	AccountServiceTarget string `mapstructure:"ACCOUNT_SERVICE_TARGET"`
-	RABBITMQURL          string `mapstructure:"RABBITMQ_URL"`
+	GRPCPort             string        `mapstructure:"GRPC_PORT"`
+	HTTPPort             string        `mapstructure:"HTTP_PORT"`
+	PostgresURL          string        `mapstructure:"POSTGRES_URL"`
+	ElasticsearchURL     string        `mapstructure:"ELASTICSEARCH_URL"`
+	JWKSURL              string        `mapstructure:"JWKS_URL"`
+	JWKSCacheTTL         time.Duration `mapstructure:"JWKS_CACHE_TTL"`
+	AccountServiceTarget string        `mapstructure:"ACCOUNT_SERVICE_TARGET"`
+	RABBITMQURL          string        `mapstructure:"RABBITMQ_URL"`
+	IdempotencyKeyTTL    time.Duration `mapstructure:"IDEMPOTENCY_KEY_TTL"`
+	// UnverifiedTransferLimit is the largest transfer, in minor units, an
+	// account with an unverified email may make.
+	UnverifiedTransferLimit int64 `mapstructure:"UNVERIFIED_TRANSFER_LIMIT"`
+	// ShutdownDrainDelay is how long the service reports not-ready before it
+	// stops accepting connections.
+	ShutdownDrainDelay time.Duration `mapstructure:"SHUTDOWN_DRAIN_DELAY"`
+	// TracesExporter is none, otlp or stdout.
+	TracesExporter string `mapstructure:"OTEL_TRACES_EXPORTER"`
+	OTLPEndpoint   string `mapstructure:"OTEL_EXPORTER_OTLP_ENDPOINT"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
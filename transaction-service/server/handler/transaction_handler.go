@@ -1,8 +1,319 @@
 package handler
 
-import "github.com/zuyatna/emoney-microservice/transaction-service/server/pb"
+import (
+	"context"
 
+	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/apperr"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/middleware"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/money"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/pb"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/usecase"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// idempotencyKeyHeader is the metadata key the gateway forwards the
+// Idempotency-Key HTTP header as.
+const idempotencyKeyHeader = "idempotency-key"
+
+// ErrNotAccountOwner is returned when a caller acts on another user's account.
+var ErrNotAccountOwner = apperr.New(apperr.ErrPermissionDenied, "NOT_ACCOUNT_OWNER", "you can only access your own account")
+
+// ErrServiceOnly is returned when a caller other than account-service calls an
+// RPC meant only for it.
+var ErrServiceOnly = apperr.New(apperr.ErrPermissionDenied, "SERVICE_ONLY", "only account-service can call this method")
+
+// TransactionHandler returns use case errors as they are; the error
+// interceptor turns them into gRPC statuses.
 type TransactionHandler struct {
 	pb.UnimplementedTransactionServiceServer
-	
-}
\ No newline at end of file
+	usecase       usecase.TransactionUseCase
+	searchUseCase usecase.SearchUseCase
+	logger        *logrus.Entry
+}
+
+func NewTransactionHandler(usecase usecase.TransactionUseCase, searchUseCase usecase.SearchUseCase, logger *logrus.Entry) *TransactionHandler {
+	return &TransactionHandler{usecase: usecase, searchUseCase: searchUseCase, logger: logger}
+}
+
+// Topup credits the caller's own wallet only.
+func (h *TransactionHandler) Topup(ctx context.Context, req *pb.TopupRequest) (*pb.TransactionResponse, error) {
+	claims, ok := middleware.ClaimsFromContext(ctx)
+	if !ok || claims.ID != req.GetAccountId() {
+		return nil, ErrNotAccountOwner
+	}
+
+	amount, err := requestAmount(req.GetMoney(), req.GetAmount())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.usecase.Topup(ctx, req.GetAccountId(), amount, req.GetNotes(), idempotencyKey(ctx, req.GetIdempotencyKey()))
+	if err != nil {
+		return nil, err
+	}
+
+	h.logger.WithFields(logrus.Fields{"account_id": tx.ToAccountID, "transaction_id": tx.ID}).Info("Topup successful")
+	return &pb.TransactionResponse{
+		TransactionId: tx.ID,
+		Status:        "success",
+		Message:       "Topup successful",
+	}, nil
+}
+
+func (h *TransactionHandler) Transfer(ctx context.Context, req *pb.TransaferRequest) (*pb.TransactionResponse, error) {
+	claims, ok := middleware.ClaimsFromContext(ctx)
+	if !ok || claims.ID != req.GetFromAccountId() {
+		return nil, ErrNotAccountOwner
+	}
+
+	amount, err := requestAmount(req.GetMoney(), req.GetAmount())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.usecase.Transfer(ctx, req.GetFromAccountId(), req.GetToAccountId(), amount, req.GetNotes(), idempotencyKey(ctx, req.GetIdempotencyKey()))
+	if err != nil {
+		return nil, err
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"from_account_id": tx.FromAccountID,
+		"to_account_id":   tx.ToAccountID,
+		"transaction_id":  tx.ID,
+	}).Info("Transfer successful")
+	return &pb.TransactionResponse{
+		TransactionId: tx.ID,
+		Status:        "success",
+		Message:       "Transfer successful",
+	}, nil
+}
+
+func (h *TransactionHandler) GetHistory(ctx context.Context, req *pb.GetHistoryRequest) (*pb.GetHistoryResponse, error) {
+	claims, ok := middleware.ClaimsFromContext(ctx)
+	if !ok || claims.ID != req.GetAccountId() {
+		return nil, ErrNotAccountOwner
+	}
+
+	filter := historyFilter(req.GetAccountId(), req.GetTransactionType(), req.GetDirection(),
+		req.GetFromTime(), req.GetToTime(), req.GetMinAmount(), req.GetMaxAmount())
+
+	history, err := h.usecase.GetHistory(ctx, filter, req.GetPageToken(), int(req.GetLimit()))
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]*pb.Transaction, 0, len(history.Transactions))
+	for _, tx := range history.Transactions {
+		transactions = append(transactions, toPBTransaction(tx))
+	}
+
+	return &pb.GetHistoryResponse{
+		Transactions:  transactions,
+		Limit:         int32(history.Limit),
+		NextPageToken: history.NextPageToken,
+	}, nil
+}
+
+// SearchTransactions searches the caller's own transactions only.
+func (h *TransactionHandler) SearchTransactions(ctx context.Context, req *pb.SearchTransactionsRequest) (*pb.SearchTransactionsResponse, error) {
+	claims, ok := middleware.ClaimsFromContext(ctx)
+	if !ok || claims.ID != req.GetAccountId() {
+		return nil, ErrNotAccountOwner
+	}
+
+	q := &model.SearchQuery{
+		Filter: historyFilter(req.GetAccountId(), req.GetTransactionType(), req.GetDirection(),
+			req.GetFromTime(), req.GetToTime(), req.GetMinAmount(), req.GetMaxAmount()),
+		Text:  req.GetQuery(),
+		Sort:  searchSorts[req.GetSort()],
+		Limit: int(req.GetLimit()),
+	}
+	result, err := h.searchUseCase.SearchTransactions(ctx, q, req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]*pb.SearchHit, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		highlights := make(map[string]*pb.Highlight, len(hit.Highlights))
+		for field, fragments := range hit.Highlights {
+			highlights[field] = &pb.Highlight{Fragments: fragments}
+		}
+		hits = append(hits, &pb.SearchHit{
+			Transaction:     toPBTransaction(hit.Transaction.Transaction()),
+			FromAccountName: hit.Transaction.FromAccountName,
+			ToAccountName:   hit.Transaction.ToAccountName,
+			Score:           hit.Score,
+			Highlights:      highlights,
+		})
+	}
+
+	return &pb.SearchTransactionsResponse{
+		Hits:          hits,
+		Total:         result.Total,
+		Limit:         int32(q.Limit),
+		NextPageToken: result.NextPageToken,
+	}, nil
+}
+
+// GetSpendingSummary summarizes the caller's own transactions only.
+func (h *TransactionHandler) GetSpendingSummary(ctx context.Context, req *pb.GetSpendingSummaryRequest) (*pb.GetSpendingSummaryResponse, error) {
+	claims, ok := middleware.ClaimsFromContext(ctx)
+	if !ok || claims.ID != req.GetAccountId() {
+		return nil, ErrNotAccountOwner
+	}
+
+	q := &model.SpendingSummaryQuery{
+		AccountID:         req.GetAccountId(),
+		Interval:          summaryIntervals[req.GetInterval()],
+		TimeZone:          req.GetTimeZone(),
+		TopCounterparties: int(req.GetTopCounterparties()),
+	}
+	if req.GetFromTime() != nil {
+		q.From = req.GetFromTime().AsTime()
+	}
+	if req.GetToTime() != nil {
+		q.To = req.GetToTime().AsTime()
+	}
+
+	summary, err := h.searchUseCase.GetSpendingSummary(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := func(minorUnits int64) *pb.Money {
+		return &pb.Money{CurrencyCode: summary.Currency, MinorUnits: minorUnits}
+	}
+	counterparties := func(parties []model.Counterparty) []*pb.Counterparty {
+		result := make([]*pb.Counterparty, 0, len(parties))
+		for _, p := range parties {
+			result = append(result, &pb.Counterparty{
+				AccountId: p.AccountID,
+				Name:      p.Name,
+				Amount:    amount(p.Amount),
+				Count:     p.Count,
+			})
+		}
+		return result
+	}
+
+	resp := &pb.GetSpendingSummaryResponse{
+		TotalIncoming: amount(summary.TotalIncoming),
+		TotalOutgoing: amount(summary.TotalOutgoing),
+		Buckets:       make([]*pb.SpendingBucket, 0, len(summary.Buckets)),
+		TopPayees:     counterparties(summary.TopPayees),
+		TopPayers:     counterparties(summary.TopPayers),
+		ByType:        make([]*pb.TypeBreakdown, 0, len(summary.ByType)),
+	}
+	for _, b := range summary.Buckets {
+		resp.Buckets = append(resp.Buckets, &pb.SpendingBucket{
+			Start:    timestamppb.New(b.Start),
+			Incoming: amount(b.Incoming),
+			Outgoing: amount(b.Outgoing),
+			Count:    b.Count,
+		})
+	}
+	for _, t := range summary.ByType {
+		resp.ByType = append(resp.ByType, &pb.TypeBreakdown{
+			TransactionType: string(t.TransactionType),
+			Incoming:        amount(t.Incoming),
+			Outgoing:        amount(t.Outgoing),
+			Count:           t.Count,
+		})
+	}
+	return resp, nil
+}
+
+var summaryIntervals = map[pb.SummaryInterval]model.SummaryInterval{
+	pb.SummaryInterval_SUMMARY_INTERVAL_DAY:   model.IntervalDay,
+	pb.SummaryInterval_SUMMARY_INTERVAL_WEEK:  model.IntervalWeek,
+	pb.SummaryInterval_SUMMARY_INTERVAL_MONTH: model.IntervalMonth,
+}
+
+var searchSorts = map[pb.SearchSort]model.SearchSort{
+	pb.SearchSort_SEARCH_SORT_RELEVANCE:   model.SortRelevance,
+	pb.SearchSort_SEARCH_SORT_NEWEST:      model.SortNewest,
+	pb.SearchSort_SEARCH_SORT_OLDEST:      model.SortOldest,
+	pb.SearchSort_SEARCH_SORT_AMOUNT_DESC: model.SortAmountDesc,
+	pb.SearchSort_SEARCH_SORT_AMOUNT_ASC:  model.SortAmountAsc,
+}
+
+func historyFilter(accountID, transactionType string, direction pb.Direction, from, to *timestamppb.Timestamp, minAmount, maxAmount int64) model.HistoryFilter {
+	filter := model.HistoryFilter{
+		AccountID:       accountID,
+		TransactionType: model.TransactionType(transactionType),
+		MinAmount:       minAmount,
+		MaxAmount:       maxAmount,
+	}
+	switch direction {
+	case pb.Direction_DIRECTION_INCOMING:
+		filter.Direction = model.Incoming
+	case pb.Direction_DIRECTION_OUTGOING:
+		filter.Direction = model.Outgoing
+	}
+	if from != nil {
+		filter.From = from.AsTime()
+	}
+	if to != nil {
+		filter.To = to.AsTime()
+	}
+	return filter
+}
+
+// CloseWallet closes a wallet, which must be empty. Only account-service may
+// call it, after checking the owner's password; a user closing their wallet
+// directly would leave it closed under an open account.
+func (h *TransactionHandler) CloseWallet(ctx context.Context, req *pb.CloseWalletRequest) (*pb.CloseWalletResponse, error) {
+	claims, ok := middleware.ClaimsFromContext(ctx)
+	if !ok || !claims.HasScope(model.ScopeCloseWallet) {
+		return nil, ErrServiceOnly
+	}
+
+	if err := h.usecase.CloseWallet(ctx, req.GetAccountId()); err != nil {
+		return nil, err
+	}
+
+	h.logger.WithField("account_id", req.GetAccountId()).Info("Wallet closed")
+	return &pb.CloseWalletResponse{Message: "Wallet closed"}, nil
+}
+
+func toPBTransaction(tx *model.Transaction) *pb.Transaction {
+	return &pb.Transaction{
+		Id:              tx.ID,
+		FromAccountId:   tx.FromAccountID,
+		ToAccountId:     tx.ToAccountID,
+		Amount:          &pb.Money{CurrencyCode: tx.Currency, MinorUnits: tx.Amount},
+		TransactionType: string(tx.TransactionType),
+		Notes:           tx.Notes,
+		CreatedAt:       timestamppb.New(tx.CreatedAt),
+	}
+}
+
+// requestAmount prefers the Money field and falls back to the deprecated decimal
+// amount that older REST clients send.
+func requestAmount(m *pb.Money, legacyAmount string) (money.Money, error) {
+	if m != nil {
+		return money.New(m.GetMinorUnits(), m.GetCurrencyCode()), nil
+	}
+	if legacyAmount == "" {
+		return money.Money{Currency: money.DefaultCurrency}, nil
+	}
+	return money.ParseDecimal(legacyAmount, money.DefaultCurrency)
+}
+
+// idempotencyKey prefers the key in the request body and falls back to the
+// Idempotency-Key header.
+func idempotencyKey(ctx context.Context, fromRequest string) string {
+	if fromRequest != "" {
+		return fromRequest
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(idempotencyKeyHeader); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/middleware"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/money"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/pb"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/usecase"
+)
+
+const (
+	ownAccountID   = "0194f1c2-7c5a-7b1e-9d3e-2f6a8b9c0d1e"
+	otherAccountID = "0194f1c2-7c5a-7b1e-9d3e-2f6a8b9c0d1f"
+)
+
+// fakeTransactionUseCase records the topups it is asked for. Methods the tests
+// do not use panic through the embedded nil interface.
+type fakeTransactionUseCase struct {
+	usecase.TransactionUseCase
+	topups []string
+}
+
+func (f *fakeTransactionUseCase) Topup(_ context.Context, accountID string, amount money.Money, _, _ string) (*model.Transaction, error) {
+	f.topups = append(f.topups, accountID)
+	return &model.Transaction{
+		ID:              "tx-1",
+		ToAccountID:     accountID,
+		Amount:          amount.Amount,
+		Currency:        amount.Currency,
+		TransactionType: model.Topup,
+		CreatedAt:       time.Now(),
+	}, nil
+}
+
+func newTestHandler(uc usecase.TransactionUseCase) *TransactionHandler {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewTransactionHandler(uc, nil, logrus.NewEntry(logger))
+}
+
+func TestTopupOwnership(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  *model.CustomClaim
+		wantErr error
+	}{
+		{name: "own account", claims: &model.CustomClaim{ID: ownAccountID}},
+		{name: "another user's account", claims: &model.CustomClaim{ID: otherAccountID}, wantErr: ErrNotAccountOwner},
+		{name: "no claims", wantErr: ErrNotAccountOwner},
+		{
+			name: "service token",
+			claims: &model.CustomClaim{
+				Scope:            model.ScopeCloseWallet,
+				RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"transaction-service"}},
+			},
+			wantErr: ErrNotAccountOwner,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := &fakeTransactionUseCase{}
+			h := newTestHandler(uc)
+
+			ctx := context.Background()
+			if tt.claims != nil {
+				ctx = middleware.ContextWithClaims(ctx, tt.claims)
+			}
+			req := &pb.TopupRequest{
+				AccountId: ownAccountID,
+				Money:     &pb.Money{CurrencyCode: "IDR", MinorUnits: 10000},
+			}
+
+			_, err := h.Topup(ctx, req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Topup() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && len(uc.topups) != 0 {
+				t.Errorf("rejected topup reached the use case: %v", uc.topups)
+			}
+			if tt.wantErr == nil && (len(uc.topups) != 1 || uc.topups[0] != ownAccountID) {
+				t.Errorf("topups = %v, want one for %s", uc.topups, ownAccountID)
+			}
+		})
+	}
+}
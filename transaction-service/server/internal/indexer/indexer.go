@@ -0,0 +1,113 @@
+// Package indexer keeps the Elasticsearch transactions index in sync with
+// Postgres outside the request path.
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/repository"
+)
+
+const (
+	pollInterval = time.Second
+	batchSize    = 500
+)
+
+var (
+	// lagSeconds is how long the oldest transaction still waiting to be
+	// indexed has been waiting, 0 when the index is up to date.
+	lagSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "search_indexer_lag_seconds",
+		Help: "Age of the oldest transaction waiting to be indexed.",
+	})
+	indexed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "search_indexer_indexed_total",
+		Help: "Transactions taken off the search index outbox.",
+	})
+	failures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "search_indexer_failures_total",
+		Help: "Indexing batches that failed.",
+	})
+)
+
+// Indexer indexes the transactions queued in the search index outbox. Failed
+// documents are retried with exponential backoff, so transactions succeed
+// even while Elasticsearch is unavailable and become searchable once it is back.
+type Indexer struct {
+	outboxRepo repository.IndexOutboxRepository
+	indexRepo  repository.IndexRepository
+	logger     *logrus.Logger
+	indexReady bool
+}
+
+func NewIndexer(outboxRepo repository.IndexOutboxRepository, indexRepo repository.IndexRepository, logger *logrus.Logger) *Indexer {
+	return &Indexer{
+		outboxRepo: outboxRepo,
+		indexRepo:  indexRepo,
+		logger:     logger,
+	}
+}
+
+// Run indexes pending transactions until ctx is cancelled. A full batch is
+// followed immediately by the next one so a backlog drains without waiting
+// for the ticker.
+func (i *Indexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		batch, err := i.indexBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			failures.Inc()
+			i.logger.WithError(err).Error("Error indexing transactions")
+		}
+		if batch.Indexed > 0 {
+			indexed.Add(float64(batch.Indexed))
+			i.logger.WithField("indexed", batch.Indexed).Debug("Indexed transactions")
+		}
+		i.updateLag(ctx)
+		// A full batch may have left more due rows behind, even if some of
+		// its own documents failed and were put back for a retry.
+		if err == nil && batch.Fetched == batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			i.logger.Info("Search indexer stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (i *Indexer) indexBatch(ctx context.Context) (*repository.IndexBatch, error) {
+	// Documents must not be written before the alias exists, or Elasticsearch
+	// would create an unversioned index with a dynamic mapping.
+	if !i.indexReady {
+		if err := i.indexRepo.EnsureIndex(ctx); err != nil {
+			return &repository.IndexBatch{}, err
+		}
+		i.indexReady = true
+	}
+	return i.outboxRepo.ProcessPending(ctx, batchSize, i.indexRepo.IndexDocuments)
+}
+
+func (i *Indexer) updateLag(ctx context.Context) {
+	oldest, pending, err := i.outboxRepo.OldestPending(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			i.logger.WithError(err).Error("Error measuring search indexer lag")
+		}
+		return
+	}
+	if !pending {
+		lagSeconds.Set(0)
+		return
+	}
+	lagSeconds.Set(time.Since(oldest).Seconds())
+}
@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/repository"
+)
+
+// fakeOutboxRepository answers ProcessPending with batches in order and
+// cancels the run once they are used up, so Run returns after the last one
+// instead of waiting for the ticker.
+type fakeOutboxRepository struct {
+	batches []fakeBatch
+	cancel  context.CancelFunc
+	calls   int
+}
+
+type fakeBatch struct {
+	fetched int
+	indexed int
+	err     error
+}
+
+func (f *fakeOutboxRepository) ProcessPending(_ context.Context, limit int, _ func(context.Context, []*model.TransactionDocument) (map[string]error, error)) (*repository.IndexBatch, error) {
+	f.calls++
+	if f.calls >= len(f.batches) {
+		f.cancel()
+	}
+	if f.calls > len(f.batches) {
+		return &repository.IndexBatch{}, nil
+	}
+	b := f.batches[f.calls-1]
+	if b.fetched > limit {
+		panic("batch larger than the limit")
+	}
+	return &repository.IndexBatch{Fetched: b.fetched, Indexed: b.indexed}, b.err
+}
+
+func (f *fakeOutboxRepository) OldestPending(context.Context) (time.Time, bool, error) {
+	return time.Time{}, false, nil
+}
+
+// fakeIndexRepository only creates the index. Methods the indexer does not use
+// panic through the embedded nil interface.
+type fakeIndexRepository struct {
+	repository.IndexRepository
+	ensured int
+}
+
+func (f *fakeIndexRepository) EnsureIndex(context.Context) error {
+	f.ensured++
+	return nil
+}
+
+func TestRunDrainsFullBatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		batches []fakeBatch
+	}{
+		{name: "partial batch", batches: []fakeBatch{{fetched: 10, indexed: 10}}},
+		{name: "full batch then empty", batches: []fakeBatch{{fetched: batchSize, indexed: batchSize}, {}}},
+		{
+			name: "full batch with failed documents",
+			batches: []fakeBatch{
+				{fetched: batchSize, indexed: batchSize - 2},
+				{fetched: batchSize, indexed: 0},
+				{fetched: 3, indexed: 3},
+			},
+		},
+		{name: "failed batch waits", batches: []fakeBatch{{fetched: batchSize, err: errors.New("elasticsearch unavailable")}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			outbox := &fakeOutboxRepository{batches: tt.batches, cancel: cancel}
+			index := &fakeIndexRepository{}
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+
+			done := make(chan struct{})
+			go func() {
+				NewIndexer(outbox, index, logger).Run(ctx)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run did not stop")
+			}
+
+			// Each batch before the last must have gone straight on to the
+			// next one rather than waiting a poll interval.
+			if outbox.calls != len(tt.batches) {
+				t.Errorf("processed %d batches, want %d", outbox.calls, len(tt.batches))
+			}
+			if index.ensured != 1 {
+				t.Errorf("ensured the index %d times, want once", index.ensured)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+// Package jwks verifies account-service access tokens against the public keys
+// account-service publishes at /.well-known/jwks.json.
+package jwks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// minRefreshInterval limits how often a token with an unknown kid can make
+	// the cache refetch the key set.
+	minRefreshInterval = 30 * time.Second
+	fetchTimeout       = 5 * time.Second
+)
+
+var (
+	ErrUnknownKey  = errors.New("unknown signing key")
+	ErrUnsupported = errors.New("unexpected signing method")
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// Cache holds the key set fetched from url and refetches it once ttl has
+// passed, or earlier when a token is signed with a key it has not seen yet,
+// which is how a newly rotated key is picked up. Fetches happen outside the
+// lock, one at a time, so verifying tokens never waits on a fetch it does not
+// need.
+type Cache struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]ed25519.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	fetchErr    error
+	// fetching is closed when the fetch in progress ends; nil when none is.
+	fetching chan struct{}
+}
+
+func NewCache(url string, ttl time.Duration) *Cache {
+	return &Cache{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: fetchTimeout},
+	}
+}
+
+// Refresh fetches the key set, replacing the cached keys.
+func (c *Cache) Refresh(ctx context.Context) error {
+	keys, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+func (c *Cache) fetch(ctx context.Context) (map[string]ed25519.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: unexpected status %s", resp.Status)
+	}
+
+	var set jwks
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]ed25519.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "OKP" || k.Crv != "Ed25519" || k.Kid == "" {
+			continue
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			continue
+		}
+		keys[k.Kid] = ed25519.PublicKey(x)
+	}
+	return keys, nil
+}
+
+// startFetch fetches the key set in the background and returns a channel that
+// is closed when it is done. c.mu must be held.
+func (c *Cache) startFetch(ctx context.Context) chan struct{} {
+	done := make(chan struct{})
+	c.fetching = done
+	c.attemptedAt = time.Now()
+
+	// The fetch outlives the request that started it, which may be cancelled
+	// while other requests wait for the result.
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		keys, err := c.fetch(ctx)
+
+		c.mu.Lock()
+		if err == nil {
+			c.keys = keys
+			c.fetchedAt = time.Now()
+		}
+		c.fetchErr = err
+		c.fetching = nil
+		c.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+func (c *Cache) key(ctx context.Context, kid string) (ed25519.PublicKey, error) {
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	canFetch := c.fetching == nil && time.Since(c.attemptedAt) >= minRefreshInterval
+	if ok {
+		// A stale set is refetched in the background; its keys stay usable
+		// meanwhile, and while account-service is unreachable.
+		if time.Since(c.fetchedAt) >= c.ttl && canFetch {
+			c.startFetch(ctx)
+		}
+		c.mu.Unlock()
+		return key, nil
+	}
+
+	done := c.fetching
+	if done == nil {
+		if !canFetch {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+		}
+		done = c.startFetch(ctx)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if c.fetchErr != nil {
+		return nil, c.fetchErr
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+// Keyfunc resolves the verification key of a token from its kid. A fetch it
+// has to wait for is abandoned when ctx is done.
+func (c *Cache) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupported, token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return c.key(ctx, kid)
+	}
+}
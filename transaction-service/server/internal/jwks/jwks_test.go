@@ -0,0 +1,160 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type testKey struct {
+	kid        string
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+func generateKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return testKey{kid: kid, privateKey: privateKey, publicKey: publicKey}
+}
+
+func (k testKey) sign(t *testing.T) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{Subject: "acc-a"})
+	token.Header["kid"] = k.kid
+	signed, err := token.SignedString(k.privateKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+// jwksServer publishes keys as account-service does and counts the fetches.
+type jwksServer struct {
+	mu      sync.Mutex
+	keys    []testKey
+	fetches int
+}
+
+func (s *jwksServer) publish(keys ...testKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *jwksServer) fetched() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+
+	set := jwks{Keys: []jwk{}}
+	for _, k := range s.keys {
+		set.Keys = append(set.Keys, jwk{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(k.publicKey), Kid: k.kid})
+	}
+	_ = json.NewEncoder(w).Encode(set)
+}
+
+func newTestCache(t *testing.T, keys ...testKey) (*jwksServer, *Cache) {
+	t.Helper()
+	server := &jwksServer{}
+	server.publish(keys...)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	cache := NewCache(httpServer.URL, time.Hour)
+	if err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	return server, cache
+}
+
+func parse(cache *Cache, token string) error {
+	_, err := jwt.Parse(token, cache.Keyfunc(context.Background()))
+	return err
+}
+
+func TestKeyfuncSelectsKeyByKid(t *testing.T) {
+	active, previous := generateKey(t, "key-2"), generateKey(t, "key-1")
+	server, cache := newTestCache(t, active, previous)
+
+	for _, key := range []testKey{active, previous} {
+		if err := parse(cache, key.sign(t)); err != nil {
+			t.Errorf("Parse() of a token signed with %s error = %v", key.kid, err)
+		}
+	}
+
+	// A token naming one published key but signed with another is rejected.
+	forged := testKey{kid: active.kid, privateKey: previous.privateKey}
+	if err := parse(cache, forged.sign(t)); !errors.Is(err, jwt.ErrEd25519Verification) {
+		t.Errorf("Parse() of a token with the wrong kid error = %v, want ErrEd25519Verification", err)
+	}
+	if fetches := server.fetched(); fetches != 1 {
+		t.Errorf("fetched the key set %d times, want once", fetches)
+	}
+}
+
+func TestKeyfuncFetchesRotatedKey(t *testing.T) {
+	previous := generateKey(t, "key-1")
+	server, cache := newTestCache(t, previous)
+
+	rotated := generateKey(t, "key-2")
+	server.publish(rotated, previous)
+	if err := parse(cache, rotated.sign(t)); err != nil {
+		t.Fatalf("Parse() of a token signed with the rotated key error = %v", err)
+	}
+	if fetches := server.fetched(); fetches != 2 {
+		t.Errorf("fetched the key set %d times, want twice", fetches)
+	}
+	if err := parse(cache, previous.sign(t)); err != nil {
+		t.Errorf("Parse() of a token signed with the previous key error = %v", err)
+	}
+}
+
+func TestKeyfuncLimitsFetchesForUnknownKeys(t *testing.T) {
+	server, cache := newTestCache(t, generateKey(t, "key-1"))
+	unknown := generateKey(t, "key-9")
+
+	for i := 0; i < 3; i++ {
+		if err := parse(cache, unknown.sign(t)); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("Parse() %d of a token with an unknown kid error = %v, want ErrUnknownKey", i+1, err)
+		}
+	}
+	// The first unknown kid refetches the set; the next ones within
+	// minRefreshInterval do not.
+	if fetches := server.fetched(); fetches != 2 {
+		t.Errorf("fetched the key set %d times, want twice", fetches)
+	}
+}
+
+func TestKeyfuncRejectsOtherAlgorithms(t *testing.T) {
+	_, cache := newTestCache(t, generateKey(t, "key-1"))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "acc-a"})
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	if err := parse(cache, signed); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Parse() of an HS256 token error = %v, want ErrUnsupported", err)
+	}
+}
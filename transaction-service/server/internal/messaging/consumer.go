@@ -0,0 +1,155 @@
+package messaging
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/usecase"
+)
+
+const exchangeName = "emoney_exchange"
+const deadLetterExchangeName = "emoney_exchange.dlx"
+
+const (
+	accountCreatedRoutingKey = "account.created"
+	accountUpdatedRoutingKey = "account.updated"
+	accountClosedRoutingKey  = "account.closed"
+)
+
+const (
+	consumerTag      = "transaction-service"
+	retryCountHeader = "x-retry-count"
+	prefetchCount    = 10
+	maxRetries       = 5
+	retryDelay       = 5 * time.Second
+)
+
+// subscription is a durable queue bound to one routing key of emoney_exchange,
+// together with the function that processes its messages.
+type subscription struct {
+	routingKey string
+	queue      string
+	handle     func(ctx context.Context, body []byte) error
+}
+
+func (s subscription) retryQueue() string {
+	return s.queue + ".retry"
+}
+
+func (s subscription) deadQueue() string {
+	return s.queue + ".dlq"
+}
+
+func (s subscription) consumerTag() string {
+	return consumerTag + ":" + s.queue
+}
+
+// publisher is the part of amqp.Channel that schedules retries.
+type publisher interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+type AccountConsumer struct {
+	ch            *amqp.Channel
+	publisher     publisher
+	usecase       usecase.TransactionUseCase
+	logger        *logrus.Logger
+	subscriptions []subscription
+	wg            sync.WaitGroup
+	stopOnce      sync.Once
+}
+
+// NewAccountConsumer declares a queue for each account event: a durable queue
+// bound to emoney_exchange, a retry queue that hands messages back after
+// retryDelay, and a dead-letter queue for messages that exhausted maxRetries.
+// Each event has its own queue so a retried message never loses its type.
+func NewAccountConsumer(conn *amqp.Connection, usecase usecase.TransactionUseCase, logger *logrus.Logger) (*AccountConsumer, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &AccountConsumer{
+		ch:        ch,
+		publisher: ch,
+		usecase:   usecase,
+		logger:    logger,
+	}
+	c.subscriptions = []subscription{
+		{routingKey: accountCreatedRoutingKey, queue: "transaction_service.account_created", handle: c.provisionAccount},
+		{routingKey: accountUpdatedRoutingKey, queue: "transaction_service.account_updated", handle: c.updateAccount},
+		{routingKey: accountClosedRoutingKey, queue: "transaction_service.account_closed", handle: c.closeAccount},
+	}
+
+	if err := declareTopology(ch, c.subscriptions); err != nil {
+		if closeErr := ch.Close(); closeErr != nil {
+			logger.WithError(closeErr).Error("failed to close RabbitMQ channel")
+		}
+		return nil, err
+	}
+
+	if err := ch.Qos(prefetchCount, 0, false); err != nil {
+		if closeErr := ch.Close(); closeErr != nil {
+			logger.WithError(closeErr).Error("failed to close RabbitMQ channel")
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func declareTopology(ch *amqp.Channel, subscriptions []subscription) error {
+	err := ch.ExchangeDeclare(
+		exchangeName,
+		"topic", // Exchange type
+		true,    // Durable
+		false,   // Auto-deleted
+		false,   // Internal
+		false,   // No-wait
+		nil,     // Arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	err = ch.ExchangeDeclare(deadLetterExchangeName, "direct", true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range subscriptions {
+		_, err = ch.QueueDeclare(s.queue, true, false, false, false, amqp.Table{
+			"x-dead-letter-exchange":    deadLetterExchangeName,
+			"x-dead-letter-routing-key": s.routingKey,
+		})
+		if err != nil {
+			return err
+		}
+		if err := ch.QueueBind(s.queue, s.routingKey, exchangeName, false, nil); err != nil {
+			return err
+		}
+
+		// Messages published to the retry queue expire after retryDelay and are
+		// dead-lettered back onto the main queue through the default exchange.
+		_, err = ch.QueueDeclare(s.retryQueue(), true, false, false, false, amqp.Table{
+			"x-message-ttl":             retryDelay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": s.queue,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = ch.QueueDeclare(s.deadQueue(), true, false, false, false, nil)
+		if err != nil {
+			return err
+		}
+		if err := ch.QueueBind(s.deadQueue(), s.routingKey, deadLetterExchangeName, false, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const handleTimeout = 10 * time.Second
+
+var errMalformedEvent = errors.New("malformed account event")
+
+// consumed counts settled deliveries by outcome: processed, retried,
+// dead_lettered, or requeued when a retry could not be scheduled. Everything
+// but processed is a failure.
+var consumed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rabbitmq_consumed_total",
+	Help: "Messages consumed from RabbitMQ, by queue and outcome.",
+}, []string{"queue", "outcome"})
+
+// AccountCreatedEvent mirrors the event account-service publishes on account.created.
+type AccountCreatedEvent struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// AccountUpdatedEvent mirrors the event account-service publishes on account.updated.
+type AccountUpdatedEvent struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// AccountClosedEvent mirrors the event account-service publishes on account.closed.
+type AccountClosedEvent struct {
+	ID       string    `json:"id"`
+	ClosedAt time.Time `json:"closed_at"`
+}
+
+// Start consumes account events in the background until Stop is called. Each
+// queue is consumed on its own goroutine, so events of different types are not
+// ordered relative to each other; an update that overtakes the creation of its
+// account is retried until the wallet exists.
+func (c *AccountConsumer) Start() error {
+	for _, s := range c.subscriptions {
+		deliveries, err := c.ch.Consume(
+			s.queue,
+			s.consumerTag(),
+			false, // Auto-ack
+			false, // Exclusive
+			false, // No-local
+			false, // No-wait
+			nil,   // Arguments
+		)
+		if err != nil {
+			return err
+		}
+
+		c.wg.Add(1)
+		go func(s subscription) {
+			defer c.wg.Done()
+			for d := range deliveries {
+				c.handle(s, d)
+			}
+		}(s)
+
+		c.logger.WithField("queue", s.queue).Info("Consuming account events")
+	}
+	return nil
+}
+
+// Stop cancels the consumers, waits for in-flight messages to be settled and
+// closes the channel. Prefetched but unacknowledged messages are requeued by
+// the broker.
+func (c *AccountConsumer) Stop() {
+	c.stopOnce.Do(func() {
+		for _, s := range c.subscriptions {
+			if err := c.ch.Cancel(s.consumerTag(), false); err != nil {
+				c.logger.WithError(err).WithField("queue", s.queue).Error("failed to cancel account consumer")
+			}
+		}
+		c.wg.Wait()
+		if err := c.ch.Close(); err != nil {
+			c.logger.WithError(err).Error("failed to close account consumer channel")
+		}
+		c.logger.Info("Account consumer stopped")
+	})
+}
+
+func (c *AccountConsumer) handle(s subscription, d amqp.Delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), handleTimeout)
+	defer cancel()
+
+	retries := retryCount(d)
+	logger := c.logger.WithFields(logrus.Fields{"queue": s.queue, "message_id": d.MessageId, "retry": retries})
+
+	// Continue the trace of the request that produced the event.
+	ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier(d.Headers))
+	ctx, span := tracer.Start(ctx, s.queue+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", s.queue),
+			attribute.String("messaging.rabbitmq.destination.routing_key", s.routingKey),
+			attribute.String("messaging.message.id", d.MessageId),
+			attribute.Int("messaging.rabbitmq.retry_count", int(retries)),
+		),
+	)
+	defer span.End()
+
+	err := s.handle(ctx, d.Body)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if err == nil {
+		consumed.WithLabelValues(s.queue, "processed").Inc()
+		if err := d.Ack(false); err != nil {
+			logger.WithError(err).Error("failed to ack account event")
+		}
+		return
+	}
+
+	if errors.Is(err, errMalformedEvent) || retries >= maxRetries {
+		logger.WithError(err).Error("Dead-lettering account event")
+		consumed.WithLabelValues(s.queue, "dead_lettered").Inc()
+		if err := d.Nack(false, false); err != nil {
+			logger.WithError(err).Error("failed to nack account event")
+		}
+		return
+	}
+
+	logger.WithError(err).Warn("Retrying account event")
+	if err := c.retry(ctx, s, d, retries+1); err != nil {
+		// Requeue rather than lose the message if it could not be scheduled for retry.
+		logger.WithError(err).Error("failed to schedule retry")
+		consumed.WithLabelValues(s.queue, "requeued").Inc()
+		if err := d.Nack(false, true); err != nil {
+			logger.WithError(err).Error("failed to nack account event")
+		}
+		return
+	}
+	consumed.WithLabelValues(s.queue, "retried").Inc()
+	if err := d.Ack(false); err != nil {
+		logger.WithError(err).Error("failed to ack account event")
+	}
+}
+
+func (c *AccountConsumer) provisionAccount(ctx context.Context, body []byte) error {
+	var event AccountCreatedEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" {
+		return errMalformedEvent
+	}
+
+	c.logger.WithField("account_id", event.ID).Info("Provisioning wallet for new account")
+	return c.usecase.ProvisionAccount(ctx, &model.Account{
+		ID:    event.ID,
+		Name:  event.Name,
+		Email: event.Email,
+	})
+}
+
+func (c *AccountConsumer) updateAccount(ctx context.Context, body []byte) error {
+	var event AccountUpdatedEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" || event.UpdatedAt.IsZero() {
+		return errMalformedEvent
+	}
+
+	c.logger.WithField("account_id", event.ID).Info("Updating account details")
+	return c.usecase.UpdateAccount(ctx, &model.Account{
+		ID:            event.ID,
+		Name:          event.Name,
+		Email:         event.Email,
+		EmailVerified: event.EmailVerified,
+		UpdatedAt:     event.UpdatedAt,
+	})
+}
+
+// closeAccount closes the wallet of a closed account. account-service closes
+// the wallet before the account, so this normally finds it closed already.
+func (c *AccountConsumer) closeAccount(ctx context.Context, body []byte) error {
+	var event AccountClosedEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" {
+		return errMalformedEvent
+	}
+
+	c.logger.WithField("account_id", event.ID).Info("Closing wallet of closed account")
+	return c.usecase.CloseWallet(ctx, event.ID)
+}
+
+func (c *AccountConsumer) retry(ctx context.Context, s subscription, d amqp.Delivery, retries int32) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[retryCountHeader] = retries
+
+	return c.publisher.PublishWithContext(
+		ctx,
+		"", // Default exchange
+		s.retryQueue(),
+		false, // Mandatory
+		false, // Immediate
+		amqp.Publishing{
+			Headers:      headers,
+			ContentType:  d.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    d.MessageId,
+			Body:         d.Body,
+		},
+	)
+}
+
+func retryCount(d amqp.Delivery) int32 {
+	switch v := d.Headers[retryCountHeader].(type) {
+	case int32:
+		return v
+	case int64:
+		return int32(v)
+	case int:
+		return int32(v)
+	}
+	return 0
+}
@@ -0,0 +1,192 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/usecase"
+)
+
+// fakeAcknowledger records how a delivery was settled.
+type fakeAcknowledger struct {
+	acks     int
+	nacks    int
+	requeued bool
+}
+
+func (f *fakeAcknowledger) Ack(uint64, bool) error {
+	f.acks++
+	return nil
+}
+
+func (f *fakeAcknowledger) Nack(_ uint64, _ bool, requeue bool) error {
+	f.nacks++
+	f.requeued = requeue
+	return nil
+}
+
+func (f *fakeAcknowledger) Reject(_ uint64, requeue bool) error {
+	return f.Nack(0, false, requeue)
+}
+
+type publishedMessage struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+// fakePublisher records the retries it is asked to publish, failing with err.
+type fakePublisher struct {
+	published []publishedMessage
+	err       error
+}
+
+func (f *fakePublisher) PublishWithContext(_ context.Context, exchange, key string, _, _ bool, msg amqp.Publishing) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.published = append(f.published, publishedMessage{exchange: exchange, key: key, msg: msg})
+	return nil
+}
+
+// fakeTransactionUseCase records the wallets it is asked to provision. Methods
+// the tests do not use panic through the embedded nil interface.
+type fakeTransactionUseCase struct {
+	usecase.TransactionUseCase
+	provisioned []*model.Account
+}
+
+func (f *fakeTransactionUseCase) ProvisionAccount(_ context.Context, acc *model.Account) error {
+	f.provisioned = append(f.provisioned, acc)
+	return nil
+}
+
+func newTestConsumer(pub publisher, uc usecase.TransactionUseCase) *AccountConsumer {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return &AccountConsumer{publisher: pub, usecase: uc, logger: logger}
+}
+
+func TestHandleSettlesDeliveries(t *testing.T) {
+	errDatabase := errors.New("connection refused")
+	errBroker := errors.New("channel closed")
+
+	tests := []struct {
+		name       string
+		handleErr  error
+		retries    interface{}
+		publishErr error
+		wantAcks   int
+		wantNacks  int
+		// wantRequeue is whether the nack asks the broker to requeue rather
+		// than dead-letter the message.
+		wantRequeue bool
+		// wantRetry is the retry count of the message scheduled for a retry,
+		// or 0 when none is.
+		wantRetry int32
+	}{
+		{name: "processed", wantAcks: 1},
+		{name: "first failure is retried", handleErr: errDatabase, wantAcks: 1, wantRetry: 1},
+		{name: "failure is retried with the next count", handleErr: errDatabase, retries: int32(2), wantAcks: 1, wantRetry: 3},
+		{name: "count read from an int64 header", handleErr: errDatabase, retries: int64(2), wantAcks: 1, wantRetry: 3},
+		{name: "last retry", handleErr: errDatabase, retries: int32(maxRetries - 1), wantAcks: 1, wantRetry: maxRetries},
+		{name: "exhausted retries are dead-lettered", handleErr: errDatabase, retries: int32(maxRetries), wantNacks: 1},
+		{name: "malformed event is dead-lettered at once", handleErr: fmt.Errorf("decoding: %w", errMalformedEvent), wantNacks: 1},
+		{name: "unscheduled retry is requeued", handleErr: errDatabase, publishErr: errBroker, wantNacks: 1, wantRequeue: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &fakePublisher{err: tt.publishErr}
+			c := newTestConsumer(pub, nil)
+			s := subscription{
+				routingKey: accountCreatedRoutingKey,
+				queue:      "transaction_service.account_created",
+				handle:     func(context.Context, []byte) error { return tt.handleErr },
+			}
+			ack := &fakeAcknowledger{}
+			d := amqp.Delivery{
+				Acknowledger: ack,
+				Headers:      amqp.Table{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+				MessageId:    "m1",
+				ContentType:  "application/json",
+				Body:         []byte(`{"id":"acc-a"}`),
+			}
+			if tt.retries != nil {
+				d.Headers[retryCountHeader] = tt.retries
+			}
+
+			c.handle(s, d)
+
+			if ack.acks != tt.wantAcks || ack.nacks != tt.wantNacks || ack.requeued != tt.wantRequeue {
+				t.Errorf("acks %d, nacks %d, requeued %v, want %d, %d, %v",
+					ack.acks, ack.nacks, ack.requeued, tt.wantAcks, tt.wantNacks, tt.wantRequeue)
+			}
+
+			if tt.wantRetry == 0 {
+				if len(pub.published) != 0 {
+					t.Errorf("scheduled retries %+v, want none", pub.published)
+				}
+				return
+			}
+			if len(pub.published) != 1 {
+				t.Fatalf("scheduled %d retries, want 1", len(pub.published))
+			}
+			retry := pub.published[0]
+			if retry.exchange != "" || retry.key != s.retryQueue() {
+				t.Errorf("retry published to %q/%q, want the default exchange and %s", retry.exchange, retry.key, s.retryQueue())
+			}
+			if got := retry.msg.Headers[retryCountHeader]; got != tt.wantRetry {
+				t.Errorf("retry count = %v, want %d", got, tt.wantRetry)
+			}
+			if retry.msg.Headers["traceparent"] != d.Headers["traceparent"] {
+				t.Error("retry lost the trace context")
+			}
+			if string(retry.msg.Body) != string(d.Body) || retry.msg.MessageId != d.MessageId || retry.msg.DeliveryMode != amqp.Persistent {
+				t.Errorf("retry %+v does not carry the original message", retry.msg)
+			}
+		})
+	}
+}
+
+func TestProvisionAccount(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{name: "created", body: `{"id":"acc-a","name":"Ana","email":"ana@example.com"}`},
+		{name: "not json", body: `{"id":`, wantErr: errMalformedEvent},
+		{name: "no id", body: `{"name":"Ana"}`, wantErr: errMalformedEvent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := &fakeTransactionUseCase{}
+			c := newTestConsumer(&fakePublisher{}, uc)
+
+			err := c.provisionAccount(context.Background(), []byte(tt.body))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("provisionAccount() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(uc.provisioned) != 0 {
+					t.Errorf("malformed event provisioned %+v", uc.provisioned)
+				}
+				return
+			}
+			if len(uc.provisioned) != 1 {
+				t.Fatalf("provisioned %d wallets, want 1", len(uc.provisioned))
+			}
+			if acc := uc.provisioned[0]; acc.ID != "acc-a" || acc.Name != "Ana" || acc.Email != "ana@example.com" {
+				t.Errorf("provisioned %+v", acc)
+			}
+		})
+	}
+}
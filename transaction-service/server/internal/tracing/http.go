@@ -0,0 +1,19 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewHTTPClient returns a client that traces requests made within a trace,
+// such as Elasticsearch queries serving an RPC. Requests outside a trace, such
+// as health checks, create no spans.
+func NewHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport, otelhttp.WithFilter(func(r *http.Request) bool {
+			return trace.SpanContextFromContext(r.Context()).IsValid()
+		})),
+	}
+}
@@ -1,16 +1,55 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	_ "github.com/lib/pq"
 	"github.com/olivere/elastic/v7"
-	_ "github.com/rabbitmq/amqp091-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/sirupsen/logrus"
-	"github.com/zuyatna/emoney-microservice/transaction-service/server/account-service/pb"
+	"github.com/urfave/cli"
 	"github.com/zuyatna/emoney-microservice/transaction-service/server/config"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/handler"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/internal/health"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/internal/indexer"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/internal/jwks"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/internal/messaging"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/internal/tracing"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/middleware"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/pb"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/repository"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/usecase"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
-	"os"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	shutdownTimeout           = 10 * time.Second
+	defaultIdempotencyKeyTTL  = 24 * time.Hour
+	idempotencyPurgeInterval  = time.Hour
+	idempotencyKeyHTTPHeader  = "Idempotency-Key"
+	idempotencyKeyMetadataKey = "idempotency-key"
+	defaultJWKSCacheTTL       = 5 * time.Minute
+	// defaultUnverifiedTransferLimit is Rp1.000.000 in minor units.
+	defaultUnverifiedTransferLimit = 100_000_000
 )
 
 func main() {
@@ -19,10 +58,226 @@ func main() {
 	logger.SetOutput(os.Stdout)
 	logger.SetLevel(logrus.InfoLevel)
 
-	if err := runService(logger); err != nil {
+	app := &cli.App{
+		Name:  "transaction-service",
+		Usage: "A microservice for wallet topups, transfers and history",
+		Action: func(c *cli.Context) error {
+			if err := runService(logger); err != nil {
+				return err
+			}
+			logger.Info("Transaction service stopped")
+			return nil
+		},
+		Commands: []cli.Command{
+			migrateCommand(logger),
+			{
+				Name:  "ledger",
+				Usage: "Inspect and repair the double-entry ledger",
+				Subcommands: []cli.Command{
+					{
+						Name:  "audit",
+						Usage: "Report unbalanced journal entries and wallet balances that disagree with their postings",
+						Action: func(c *cli.Context) error {
+							return runLedgerAudit(logger)
+						},
+					},
+					{
+						Name:  "rebuild",
+						Usage: "Recompute every wallet balance from its postings",
+						Action: func(c *cli.Context) error {
+							return runLedgerRebuild(logger)
+						},
+					},
+				},
+			},
+			{
+				Name:  "reindex",
+				Usage: "Rebuild the transactions Elasticsearch index from Postgres and swap the alias to it",
+				Flags: []cli.Flag{
+					cli.IntFlag{
+						Name:  "batch-size",
+						Value: 1000,
+						Usage: "number of transactions read and indexed per batch",
+					},
+					cli.BoolFlag{
+						Name:  "verify",
+						Usage: "only report transactions that are missing from or differ in the index",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Bool("verify") {
+						return runReindexVerify(logger, c.Int("batch-size"))
+					}
+					return runReindex(logger, c.Int("batch-size"))
+				},
+			},
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
 		logger.WithError(err).Fatal("Transaction service failed to run")
 	}
-	logger.Info("Transaction service is running")
+}
+
+func openPostgres(ctx context.Context, cfg config.Config) (*sql.DB, error) {
+	db, err := tracing.OpenPostgres(cfg.PostgresURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func openElasticsearch(cfg config.Config) (*elastic.Client, error) {
+	return elastic.NewClient(elastic.SetURL(cfg.ElasticsearchURL), elastic.SetSniff(false), elastic.SetHttpClient(tracing.NewHTTPClient()))
+}
+
+func newReindexUseCase(cfg config.Config, db *sql.DB) (usecase.ReindexUseCase, error) {
+	esClient, err := openElasticsearch(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return usecase.NewReindexUseCase(
+		repository.NewTransactionRepository(db),
+		repository.NewIndexRepository(esClient),
+	), nil
+}
+
+func runReindex(logger *logrus.Logger, batchSize int) error {
+	cfg, err := config.LoadConfig("..")
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db, err := openPostgres(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	reindexUseCase, err := newReindexUseCase(cfg, db)
+	if err != nil {
+		return err
+	}
+	result, err := reindexUseCase.Reindex(ctx, batchSize, func(indexed int64) {
+		logger.WithField("indexed", indexed).Info("Reindexing transactions")
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"index":            result.Index,
+		"indexed":          result.Indexed,
+		"previous_indexes": result.PreviousIndexes,
+	}).Info("Transactions reindexed; previous indexes can be deleted once the new one is verified")
+	return nil
+}
+
+func runReindexVerify(logger *logrus.Logger, batchSize int) error {
+	cfg, err := config.LoadConfig("..")
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db, err := openPostgres(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	reindexUseCase, err := newReindexUseCase(cfg, db)
+	if err != nil {
+		return err
+	}
+	verification, err := reindexUseCase.Verify(ctx, batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range verification.Missing {
+		logger.WithField("transaction_id", id).Error("Transaction is missing from the index")
+	}
+	for _, id := range verification.Mismatched {
+		logger.WithField("transaction_id", id).Error("Indexed transaction differs from Postgres")
+	}
+	fields := logrus.Fields{
+		"checked":       verification.Checked,
+		"indexed_count": verification.IndexedCount,
+		"missing":       len(verification.Missing),
+		"mismatched":    len(verification.Mismatched),
+	}
+	if !verification.Clean() {
+		logger.WithFields(fields).Error("Index verification failed")
+		return errors.New("index verification failed")
+	}
+
+	logger.WithFields(fields).Info("Index verification passed")
+	return nil
+}
+
+func runLedgerAudit(logger *logrus.Logger) error {
+	cfg, err := config.LoadConfig("..")
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db, err := openPostgres(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	audit, err := usecase.NewLedgerUseCase(repository.NewLedgerRepository(db)).Audit(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, entryID := range audit.UnbalancedEntries {
+		logger.WithField("journal_entry_id", entryID).Error("Journal entry does not balance")
+	}
+	for _, m := range audit.Mismatches {
+		logger.WithFields(logrus.Fields{
+			"account_id":     m.AccountID,
+			"currency":       m.Currency,
+			"balance":        m.Balance,
+			"ledger_balance": m.LedgerBalance,
+		}).Error("Wallet balance disagrees with ledger")
+	}
+	if !audit.Clean() {
+		return errors.New("ledger audit failed")
+	}
+
+	logger.Info("Ledger audit passed")
+	return nil
+}
+
+func runLedgerRebuild(logger *logrus.Logger) error {
+	cfg, err := config.LoadConfig("..")
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db, err := openPostgres(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	updated, err := usecase.NewLedgerUseCase(repository.NewLedgerRepository(db)).RebuildBalances(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger.WithField("accounts_updated", updated).Info("Wallet balances rebuilt from ledger")
+	return nil
 }
 
 func runService(logger *logrus.Logger) error {
@@ -32,7 +287,20 @@ func runService(logger *logrus.Logger) error {
 	}
 	logger.Info("Configuration loaded")
 
-	db, err := sql.Open("postgres", cfg.PostgresURL)
+	ctx := context.Background()
+	shutdownTracing, err := tracing.Setup(ctx, "transaction-service", cfg.TracesExporter, cfg.OTLPEndpoint)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to set up tracing")
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			logger.WithError(err).Error("failed to flush traces")
+		}
+	}()
+
+	db, err := openPostgres(ctx, cfg)
 	if err != nil {
 		logger.WithError(err).Fatal("failed to connect PostgreSQL")
 	}
@@ -44,13 +312,19 @@ func runService(logger *logrus.Logger) error {
 			logger.Info("Database connection closed")
 		}
 	}(db)
+	logger.Info("Connected to PostgreSQL")
 
-	esClient, err := elastic.NewClient(elastic.SetURL(cfg.ElasticsearchURL), elastic.SetSniff(false))
+	// A simple client skips the startup health check, so the service starts and
+	// accepts transactions while Elasticsearch is unavailable.
+	esClient, err := elastic.NewSimpleClient(elastic.SetURL(cfg.ElasticsearchURL), elastic.SetHttpClient(tracing.NewHTTPClient()))
 	if err != nil {
 		logger.WithError(err).Fatal("failed to create Elasticsearch client")
 	}
 
-	accountServiceConn, err := grpc.NewClient(cfg.AccountServiceTarget, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	accountServiceConn, err := grpc.NewClient(cfg.AccountServiceTarget,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+	)
 	if err != nil {
 		logger.WithError(err).Fatal("failed to connect to account service")
 	}
@@ -62,7 +336,6 @@ func runService(logger *logrus.Logger) error {
 			logger.Info("Account service connection closed")
 		}
 	}(accountServiceConn)
-	accountServiceClient := pb.NewAccountServiceClient(accountServiceConn)
 
 	rabbitConn, err := amqp.Dial(cfg.RABBITMQURL)
 	if err != nil {
@@ -78,5 +351,222 @@ func runService(logger *logrus.Logger) error {
 	}(rabbitConn)
 	logger.Info("Connected to RabbitMQ")
 
-	// TODO: Implement the rest of the service logic here, such as setting up gRPC servers, handling requests, etc.
+	transactionRepo := repository.NewTransactionRepository(db)
+	idempotencyKeyTTL := cfg.IdempotencyKeyTTL
+	if idempotencyKeyTTL <= 0 {
+		idempotencyKeyTTL = defaultIdempotencyKeyTTL
+	}
+	unverifiedTransferLimit := cfg.UnverifiedTransferLimit
+	if unverifiedTransferLimit <= 0 {
+		unverifiedTransferLimit = defaultUnverifiedTransferLimit
+	}
+	transactionUseCase := usecase.NewTransactionUseCase(transactionRepo, idempotencyKeyTTL, unverifiedTransferLimit)
+	searchUseCase := usecase.NewSearchUseCase(repository.NewSearchRepository(esClient))
+	transactionHandler := handler.NewTransactionHandler(transactionUseCase, searchUseCase, logrus.NewEntry(logger))
+
+	accountConsumer, err := messaging.NewAccountConsumer(rabbitConn, transactionUseCase, logger)
+	if err != nil {
+		return err
+	}
+	if err := accountConsumer.Start(); err != nil {
+		return err
+	}
+	defer accountConsumer.Stop()
+
+	jwksCacheTTL := cfg.JWKSCacheTTL
+	if jwksCacheTTL <= 0 {
+		jwksCacheTTL = defaultJWKSCacheTTL
+	}
+	keyCache := jwks.NewCache(cfg.JWKSURL, jwksCacheTTL)
+	if err := keyCache.Refresh(ctx); err != nil {
+		// Not fatal: the cache fetches the key set again on the first request.
+		logger.WithError(err).Warn("failed to fetch account service JWKS")
+	}
+
+	// Search and account lookups degrade without Elasticsearch or account-service,
+	// but topups and transfers keep working, so neither affects readiness. Every
+	// replica shares them, and account-service observes this service in turn, so
+	// requiring them would only take both services down together.
+	checker := health.NewChecker(pb.TransactionService_ServiceDesc.ServiceName, logger)
+	checker.Require("postgres", db.PingContext)
+	checker.Require("rabbitmq", func(ctx context.Context) error {
+		if rabbitConn.IsClosed() {
+			return amqp.ErrClosed
+		}
+		return nil
+	})
+	checker.Observe("elasticsearch", func(ctx context.Context) error {
+		_, err := esClient.ClusterHealth().Do(ctx)
+		return err
+	})
+	accountHealth := healthpb.NewHealthClient(accountServiceConn)
+	checker.Observe("account-service", func(ctx context.Context) error {
+		resp, err := accountHealth.Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("account service is %s", resp.GetStatus())
+		}
+		return nil
+	})
+
+	authInterceptor := middleware.NewAuthInterceptor(keyCache.Keyfunc, logger)
+	metricsInterceptor := middleware.NewMetricsInterceptor()
+	errorInterceptor := middleware.NewErrorInterceptor("transaction-service", logger)
+	validationInterceptor, err := middleware.NewValidationInterceptor(logger)
+	if err != nil {
+		logger.Fatalf("Error creating request validator: %v", err)
+	}
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "transaction"))
+
+	grpcServer := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+		grpc.ChainUnaryInterceptor(metricsInterceptor.Unary(), errorInterceptor.Unary(), authInterceptor.Unary(), validationInterceptor.Unary()),
+	)
+	pb.RegisterTransactionServiceServer(grpcServer, transactionHandler)
+	healthpb.RegisterHealthServer(grpcServer, checker.GRPCServer())
+
+	grpcListener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		return err
+	}
+
+	indexerCtx, cancelIndexer := context.WithCancel(ctx)
+	defer cancelIndexer()
+	indexerDone := make(chan struct{})
+	searchIndexer := indexer.NewIndexer(repository.NewIndexOutboxRepository(db), repository.NewIndexRepository(esClient), logger)
+	go func() {
+		defer close(indexerDone)
+		searchIndexer.Run(indexerCtx)
+	}()
+
+	gatewayCtx, cancelGateway := context.WithCancel(ctx)
+	defer cancelGateway()
+
+	go purgeIdempotencyKeys(gatewayCtx, transactionUseCase, logger)
+	go checker.Watch(gatewayCtx)
+
+	gatewayMux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher),
+		runtime.WithErrorHandler(middleware.GatewayErrorHandler),
+	)
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+	}
+	if err := pb.RegisterTransactionServiceHandlerFromEndpoint(gatewayCtx, gatewayMux, "localhost:"+cfg.GRPCPort, dialOpts); err != nil {
+		return err
+	}
+	err = gatewayMux.HandlePath(http.MethodGet, "/metrics", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		promhttp.Handler().ServeHTTP(w, r)
+	})
+	if err != nil {
+		return err
+	}
+	if err := gatewayMux.HandlePath(http.MethodGet, "/healthz", checker.LiveHandler); err != nil {
+		return err
+	}
+	if err := gatewayMux.HandlePath(http.MethodGet, "/readyz", checker.ReadyHandler); err != nil {
+		return err
+	}
+	httpServer := &http.Server{
+		Addr:              ":" + cfg.HTTPPort,
+		Handler:           otelhttp.NewHandler(gatewayMux, "gateway", otelhttp.WithFilter(tracedRequest)),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	serverErrors := make(chan error, 2)
+	go func() {
+		logger.Infof("gRPC server listening on :%s", cfg.GRPCPort)
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			serverErrors <- err
+		}
+	}()
+	go func() {
+		logger.Infof("HTTP gateway listening on :%s", cfg.HTTPPort)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErrors <- err
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-quit:
+	case err := <-serverErrors:
+		logger.WithError(err).Error("server stopped unexpectedly")
+	}
+	logger.Warn("Shutting down gracefully...")
+
+	// Report not-ready first and give load balancers time to notice before the
+	// listeners close.
+	checker.Shutdown()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.WithError(err).Error("failed to shut down HTTP gateway")
+	}
+	stopGRPCServer(shutdownCtx, grpcServer)
+	accountConsumer.Stop()
+	cancelIndexer()
+	<-indexerDone
+	logger.Info("Servers stopped")
+
+	return nil
+}
+
+// tracedRequest leaves probes and scrapes out of traces.
+func tracedRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
+}
+
+// gatewayHeaderMatcher forwards the Idempotency-Key header to the gRPC handlers
+// in addition to the gateway's default headers.
+func gatewayHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, idempotencyKeyHTTPHeader) {
+		return idempotencyKeyMetadataKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// purgeIdempotencyKeys periodically deletes expired idempotency keys until ctx is done.
+func purgeIdempotencyKeys(ctx context.Context, transactionUseCase usecase.TransactionUseCase, logger *logrus.Logger) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := transactionUseCase.PurgeExpiredIdempotencyKeys(ctx)
+			if err != nil {
+				logger.WithError(err).Error("failed to purge expired idempotency keys")
+				continue
+			}
+			logger.WithField("purged", purged).Info("Expired idempotency keys purged")
+		}
+	}
+}
+
+// stopGRPCServer drains in-flight RPCs, falling back to a hard stop once ctx expires.
+func stopGRPCServer(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
 }
@@ -1 +1,95 @@
 package middleware
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+type claimsContextKey struct{}
+
+// healthServicePrefix covers the grpc.health.v1 methods, which probes call
+// without a token.
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+type AuthInterceptor struct {
+	keyfunc func(ctx context.Context) jwt.Keyfunc
+	logger  *logrus.Logger
+}
+
+// NewAuthInterceptor verifies tokens with the key the Keyfunc that keyfunc
+// returns for the call resolves from their kid.
+func NewAuthInterceptor(keyfunc func(ctx context.Context) jwt.Keyfunc, logger *logrus.Logger) *AuthInterceptor {
+	return &AuthInterceptor{
+		keyfunc: keyfunc,
+		logger:  logger,
+	}
+}
+
+// ClaimsFromContext returns the claims of the token that authenticated the call.
+func ClaimsFromContext(ctx context.Context) (*model.CustomClaim, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*model.CustomClaim)
+	return claims, ok
+}
+
+// ContextWithClaims returns a copy of ctx that carries claims, as the
+// interceptor passes them to handlers.
+func ContextWithClaims(ctx context.Context, claims *model.CustomClaim) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// Unary authenticates every call with a token issued by account-service.
+func (i *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+			return handler(ctx, req)
+		}
+
+		claims, err := i.authorize(ctx)
+		if err != nil {
+			i.logger.WithError(err).WithField("method", info.FullMethod).Error("Authorization failed")
+			return nil, err
+		}
+
+		return handler(ContextWithClaims(ctx, claims), req)
+	}
+}
+
+func (i *AuthInterceptor) authorize(ctx context.Context) (*model.CustomClaim, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "metadata is not provided")
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "authorization token is not provided")
+	}
+
+	authHeader := values[0]
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "invalid token format")
+	}
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	claims := &model.CustomClaim{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, i.keyfunc(ctx))
+	if err != nil {
+		i.logger.WithError(err).Error("JWT parsing error")
+		return nil, status.Error(codes.Unauthenticated, "token is invalid")
+	}
+
+	// User tokens name the account; service tokens name a scope instead.
+	if !token.Valid || (claims.ID == "" && claims.Scope == "") {
+		i.logger.Error("JWT token is not valid")
+		return nil, status.Error(codes.Unauthenticated, "token is not valid")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,18 @@
+-- Schema as of the first release. Wallets are provisioned from account-service
+-- events; topups have no from_account_id.
+CREATE TABLE accounts (
+    id      TEXT PRIMARY KEY,
+    name    TEXT             NOT NULL,
+    email   TEXT             NOT NULL,
+    balance DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE TABLE transactions (
+    id               TEXT PRIMARY KEY,
+    from_account_id  TEXT REFERENCES accounts (id),
+    to_account_id    TEXT             NOT NULL REFERENCES accounts (id),
+    amount           DOUBLE PRECISION NOT NULL,
+    transaction_type TEXT             NOT NULL,
+    notes            TEXT             NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
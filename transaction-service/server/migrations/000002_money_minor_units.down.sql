@@ -0,0 +1,7 @@
+ALTER TABLE transactions
+    DROP COLUMN currency,
+    ALTER COLUMN amount TYPE DOUBLE PRECISION USING amount / 100.0;
+
+ALTER TABLE accounts
+    DROP COLUMN currency,
+    ALTER COLUMN balance TYPE DOUBLE PRECISION USING balance / 100.0;
@@ -0,0 +1,11 @@
+-- Convert floating point balances and amounts to integer minor units.
+-- Every row written before this migration is in IDR, which has two minor-unit
+-- digits, so amounts are scaled by 100.
+ALTER TABLE accounts
+    ALTER COLUMN balance TYPE BIGINT USING ROUND(balance * 100)::BIGINT,
+    ALTER COLUMN balance SET DEFAULT 0,
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR';
+
+ALTER TABLE transactions
+    ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT,
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR';
@@ -0,0 +1,35 @@
+-- Double-entry ledger. Every transaction owns one journal entry whose postings
+-- balance per currency; wallet balances are credits minus debits.
+CREATE TABLE journal_entries (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    transaction_id TEXT        NOT NULL UNIQUE,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE postings (
+    id               BIGSERIAL PRIMARY KEY,
+    journal_entry_id UUID        NOT NULL REFERENCES journal_entries (id),
+    account_id       TEXT        NOT NULL,
+    direction        TEXT        NOT NULL CHECK (direction IN ('debit', 'credit')),
+    amount           BIGINT      NOT NULL CHECK (amount > 0),
+    currency         CHAR(3)     NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX postings_journal_entry_id_idx ON postings (journal_entry_id);
+CREATE INDEX postings_account_id_currency_idx ON postings (account_id, currency);
+
+-- Backfill the ledger from existing history. Topups are funded by the
+-- system:topup_funding account.
+INSERT INTO journal_entries (transaction_id, created_at)
+SELECT id::TEXT, created_at
+FROM transactions;
+
+INSERT INTO postings (journal_entry_id, account_id, direction, amount, currency, created_at)
+SELECT je.id, COALESCE(t.from_account_id::TEXT, 'system:topup_funding'), 'debit', t.amount, t.currency, t.created_at
+FROM transactions t
+JOIN journal_entries je ON je.transaction_id = t.id::TEXT
+UNION ALL
+SELECT je.id, t.to_account_id::TEXT, 'credit', t.amount, t.currency, t.created_at
+FROM transactions t
+JOIN journal_entries je ON je.transaction_id = t.id::TEXT;
@@ -0,0 +1,13 @@
+-- Client-supplied idempotency keys for Topup and Transfer, scoped to the
+-- initiating account. request_hash fingerprints the original payload.
+CREATE TABLE idempotency_keys (
+    account_id     TEXT        NOT NULL,
+    key            TEXT        NOT NULL,
+    request_hash   TEXT        NOT NULL,
+    transaction_id TEXT        NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at     TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (account_id, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
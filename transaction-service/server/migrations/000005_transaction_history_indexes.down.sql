@@ -0,0 +1,2 @@
+DROP INDEX transactions_to_account_history_idx;
+DROP INDEX transactions_from_account_history_idx;
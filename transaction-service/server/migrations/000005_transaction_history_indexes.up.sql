@@ -0,0 +1,4 @@
+-- Keyset pagination of GetHistory walks one of these per direction, ordered
+-- like the history itself.
+CREATE INDEX transactions_from_account_history_idx ON transactions (from_account_id, created_at DESC, id DESC);
+CREATE INDEX transactions_to_account_history_idx ON transactions (to_account_id, created_at DESC, id DESC);
@@ -0,0 +1 @@
+DROP INDEX transactions_created_at_id_idx;
@@ -0,0 +1,2 @@
+-- Lets the reindex command stream transactions in (created_at, id) order.
+CREATE INDEX transactions_created_at_id_idx ON transactions (created_at, id);
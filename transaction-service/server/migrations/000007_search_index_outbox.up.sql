@@ -0,0 +1,13 @@
+-- Transactions waiting to be indexed in Elasticsearch. Rows are inserted in
+-- the same transaction as the transaction they refer to and deleted by the
+-- search indexer once the document is indexed.
+CREATE TABLE search_index_outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    transaction_id  TEXT        NOT NULL,
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX search_index_outbox_next_attempt_at_idx ON search_index_outbox (next_attempt_at);
@@ -0,0 +1,3 @@
+ALTER TABLE accounts
+    DROP COLUMN profile_updated_at,
+    DROP COLUMN closed_at;
@@ -0,0 +1,6 @@
+-- Closed wallets take no part in topups or transfers. profile_updated_at is
+-- the updated_at of the last account.updated event applied, so events that
+-- arrive out of order do not overwrite newer names and emails.
+ALTER TABLE accounts
+    ADD COLUMN closed_at          TIMESTAMPTZ,
+    ADD COLUMN profile_updated_at TIMESTAMPTZ;
@@ -0,0 +1,5 @@
+-- Copied from account.updated events. Unverified accounts may only make small
+-- transfers. Wallets that exist before this migration belong to accounts
+-- account-service backfills as verified, so they start verified too.
+ALTER TABLE accounts ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE accounts SET email_verified = TRUE;
@@ -0,0 +1,25 @@
+package model
+
+import "github.com/golang-jwt/jwt/v4"
+
+// ScopeCloseWallet is carried by the tokens account-service signs for itself to
+// close wallets. Access tokens issued to users carry no scope.
+const ScopeCloseWallet = "wallets:close"
+
+// serviceAudience is the audience of the tokens account-service signs for
+// calling transaction-service.
+const serviceAudience = "transaction-service"
+
+// CustomClaim matches the access token claims issued by account-service.
+type CustomClaim struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Scope string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// HasScope reports whether the token was issued to account-service, for
+// transaction-service, with scope.
+func (c *CustomClaim) HasScope(scope string) bool {
+	return c.Scope == scope && c.VerifyAudience(serviceAudience, true)
+}
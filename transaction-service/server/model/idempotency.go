@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// IdempotencyKey ties a client-supplied key to the request it was first used
+// with and the transaction that request produced.
+type IdempotencyKey struct {
+	Key           string
+	AccountID     string
+	RequestHash   string
+	TransactionID string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+}
@@ -0,0 +1,91 @@
+package model
+
+import "time"
+
+type PostingDirection string
+
+const (
+	Debit  PostingDirection = "debit"
+	Credit PostingDirection = "credit"
+)
+
+// TopupFundingAccountID is the system ledger account that funds topups. Wallet
+// accounts are credit-normal, so a wallet's balance is its credits minus its
+// debits; money entering the platform is debited from this account.
+const TopupFundingAccountID = "system:topup_funding"
+
+type Posting struct {
+	AccountID string
+	Direction PostingDirection
+	Amount    int64
+	Currency  string
+}
+
+type JournalEntry struct {
+	ID            string
+	TransactionID string
+	Postings      []Posting
+	CreatedAt     time.Time
+}
+
+// NewJournalEntry builds the balanced postings that record tx in the ledger.
+func NewJournalEntry(tx *Transaction) *JournalEntry {
+	debitAccountID := tx.FromAccountID
+	if tx.TransactionType == Topup {
+		debitAccountID = TopupFundingAccountID
+	}
+
+	return &JournalEntry{
+		TransactionID: tx.ID,
+		Postings: []Posting{
+			{AccountID: debitAccountID, Direction: Debit, Amount: tx.Amount, Currency: tx.Currency},
+			{AccountID: tx.ToAccountID, Direction: Credit, Amount: tx.Amount, Currency: tx.Currency},
+		},
+		CreatedAt: tx.CreatedAt,
+	}
+}
+
+// Balanced reports whether debits equal credits in every currency of the entry.
+func (e *JournalEntry) Balanced() bool {
+	if len(e.Postings) < 2 {
+		return false
+	}
+
+	totals := make(map[string]int64)
+	for _, p := range e.Postings {
+		if p.Amount <= 0 {
+			return false
+		}
+		switch p.Direction {
+		case Debit:
+			totals[p.Currency] -= p.Amount
+		case Credit:
+			totals[p.Currency] += p.Amount
+		default:
+			return false
+		}
+	}
+	for _, total := range totals {
+		if total != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// BalanceMismatch is a wallet whose stored balance disagrees with its postings.
+type BalanceMismatch struct {
+	AccountID     string
+	Currency      string
+	Balance       int64
+	LedgerBalance int64
+}
+
+type LedgerAudit struct {
+	UnbalancedEntries []string
+	Mismatches        []BalanceMismatch
+}
+
+func (a *LedgerAudit) Clean() bool {
+	return len(a.UnbalancedEntries) == 0 && len(a.Mismatches) == 0
+}
@@ -0,0 +1,136 @@
+package model
+
+import "testing"
+
+func TestNewJournalEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		tx         *Transaction
+		wantDebit  string
+		wantCredit string
+	}{
+		{
+			name:       "topup",
+			tx:         &Transaction{ID: "tx-1", ToAccountID: "acc-a", Amount: 10000, Currency: "IDR", TransactionType: Topup},
+			wantDebit:  TopupFundingAccountID,
+			wantCredit: "acc-a",
+		},
+		{
+			name:       "transfer",
+			tx:         &Transaction{ID: "tx-2", FromAccountID: "acc-a", ToAccountID: "acc-b", Amount: 2500, Currency: "USD", TransactionType: Transfer},
+			wantDebit:  "acc-a",
+			wantCredit: "acc-b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := NewJournalEntry(tt.tx)
+			if !entry.Balanced() {
+				t.Fatalf("entry for %s is not balanced: %+v", tt.name, entry.Postings)
+			}
+			if entry.TransactionID != tt.tx.ID {
+				t.Errorf("TransactionID = %q, want %q", entry.TransactionID, tt.tx.ID)
+			}
+
+			want := []Posting{
+				{AccountID: tt.wantDebit, Direction: Debit, Amount: tt.tx.Amount, Currency: tt.tx.Currency},
+				{AccountID: tt.wantCredit, Direction: Credit, Amount: tt.tx.Amount, Currency: tt.tx.Currency},
+			}
+			if len(entry.Postings) != len(want) {
+				t.Fatalf("got %d postings, want %d", len(entry.Postings), len(want))
+			}
+			for i := range want {
+				if entry.Postings[i] != want[i] {
+					t.Errorf("posting %d = %+v, want %+v", i, entry.Postings[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestJournalEntryBalanced(t *testing.T) {
+	tests := []struct {
+		name     string
+		postings []Posting
+		want     bool
+	}{
+		{
+			name: "balanced",
+			postings: []Posting{
+				{AccountID: "a", Direction: Debit, Amount: 100, Currency: "IDR"},
+				{AccountID: "b", Direction: Credit, Amount: 100, Currency: "IDR"},
+			},
+			want: true,
+		},
+		{
+			name: "split credit",
+			postings: []Posting{
+				{AccountID: "a", Direction: Debit, Amount: 100, Currency: "IDR"},
+				{AccountID: "b", Direction: Credit, Amount: 99, Currency: "IDR"},
+				{AccountID: "c", Direction: Credit, Amount: 1, Currency: "IDR"},
+			},
+			want: true,
+		},
+		{
+			name: "balanced in each currency",
+			postings: []Posting{
+				{AccountID: "a", Direction: Debit, Amount: 100, Currency: "IDR"},
+				{AccountID: "b", Direction: Credit, Amount: 100, Currency: "IDR"},
+				{AccountID: "a", Direction: Debit, Amount: 5, Currency: "USD"},
+				{AccountID: "b", Direction: Credit, Amount: 5, Currency: "USD"},
+			},
+			want: true,
+		},
+		{
+			name: "credits exceed debits",
+			postings: []Posting{
+				{AccountID: "a", Direction: Debit, Amount: 100, Currency: "IDR"},
+				{AccountID: "b", Direction: Credit, Amount: 101, Currency: "IDR"},
+			},
+		},
+		{
+			name: "balanced only across currencies",
+			postings: []Posting{
+				{AccountID: "a", Direction: Debit, Amount: 100, Currency: "IDR"},
+				{AccountID: "b", Direction: Credit, Amount: 100, Currency: "USD"},
+			},
+		},
+		{
+			name: "single posting",
+			postings: []Posting{
+				{AccountID: "a", Direction: Debit, Amount: 100, Currency: "IDR"},
+			},
+		},
+		{
+			name: "zero amounts",
+			postings: []Posting{
+				{AccountID: "a", Direction: Debit, Amount: 0, Currency: "IDR"},
+				{AccountID: "b", Direction: Credit, Amount: 0, Currency: "IDR"},
+			},
+		},
+		{
+			name: "negative amounts",
+			postings: []Posting{
+				{AccountID: "a", Direction: Debit, Amount: -100, Currency: "IDR"},
+				{AccountID: "b", Direction: Credit, Amount: -100, Currency: "IDR"},
+			},
+		},
+		{
+			name: "unknown direction",
+			postings: []Posting{
+				{AccountID: "a", Direction: "sideways", Amount: 100, Currency: "IDR"},
+				{AccountID: "b", Direction: "sideways", Amount: 100, Currency: "IDR"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &JournalEntry{Postings: tt.postings}
+			if got := entry.Balanced(); got != tt.want {
+				t.Errorf("Balanced() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package model
+
+import "time"
+
+// TransactionDocument is a transaction as it is indexed in Elasticsearch,
+// denormalized with the names of both parties so they can be searched.
+type TransactionDocument struct {
+	ID              string          `json:"id"`
+	FromAccountID   string          `json:"from_account_id,omitempty"`
+	FromAccountName string          `json:"from_account_name,omitempty"`
+	ToAccountID     string          `json:"to_account_id"`
+	ToAccountName   string          `json:"to_account_name,omitempty"`
+	Amount          int64           `json:"amount"` // minor units of Currency
+	Currency        string          `json:"currency"`
+	TransactionType TransactionType `json:"transaction_type"`
+	Notes           string          `json:"notes"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+func NewTransactionDocument(tx *Transaction, fromAccountName, toAccountName string) *TransactionDocument {
+	return &TransactionDocument{
+		ID:              tx.ID,
+		FromAccountID:   tx.FromAccountID,
+		FromAccountName: fromAccountName,
+		ToAccountID:     tx.ToAccountID,
+		ToAccountName:   toAccountName,
+		Amount:          tx.Amount,
+		Currency:        tx.Currency,
+		TransactionType: tx.TransactionType,
+		Notes:           tx.Notes,
+		CreatedAt:       tx.CreatedAt,
+	}
+}
+
+func (d *TransactionDocument) Transaction() *Transaction {
+	return &Transaction{
+		ID:              d.ID,
+		FromAccountID:   d.FromAccountID,
+		ToAccountID:     d.ToAccountID,
+		Amount:          d.Amount,
+		Currency:        d.Currency,
+		TransactionType: d.TransactionType,
+		Notes:           d.Notes,
+		CreatedAt:       d.CreatedAt,
+	}
+}
+
+// Equal reports whether d and other describe the same transaction.
+func (d *TransactionDocument) Equal(other *TransactionDocument) bool {
+	return d.ID == other.ID &&
+		d.FromAccountID == other.FromAccountID &&
+		d.FromAccountName == other.FromAccountName &&
+		d.ToAccountID == other.ToAccountID &&
+		d.ToAccountName == other.ToAccountName &&
+		d.Amount == other.Amount &&
+		d.Currency == other.Currency &&
+		d.TransactionType == other.TransactionType &&
+		d.Notes == other.Notes &&
+		d.CreatedAt.Equal(other.CreatedAt)
+}
+
+// ReindexResult describes a finished reindex.
+type ReindexResult struct {
+	Index           string
+	Indexed         int64
+	PreviousIndexes []string
+}
+
+// IndexVerification compares the transactions index with Postgres.
+type IndexVerification struct {
+	Checked      int64
+	IndexedCount int64
+	Missing      []string
+	Mismatched   []string
+}
+
+func (v *IndexVerification) Clean() bool {
+	return len(v.Missing) == 0 && len(v.Mismatched) == 0 && v.IndexedCount == v.Checked
+}
+
+type SearchSort string
+
+const (
+	SortRelevance  SearchSort = "relevance"
+	SortNewest     SearchSort = "newest"
+	SortOldest     SearchSort = "oldest"
+	SortAmountDesc SearchSort = "amount_desc"
+	SortAmountAsc  SearchSort = "amount_asc"
+)
+
+// SearchQuery is a free-text search over the transactions of
+// Filter.AccountID, which is always applied.
+type SearchQuery struct {
+	Filter HistoryFilter
+	Text   string // matched against notes and counterparty names
+	Sort   SearchSort
+	Limit  int
+	// SearchAfter holds the sort values of the last hit of the previous page.
+	SearchAfter []interface{}
+}
+
+type SearchHit struct {
+	Transaction *TransactionDocument
+	Score       float64
+	// Highlights maps a document field to its matching fragments.
+	Highlights map[string][]string
+	SortValues []interface{}
+}
+
+type SearchResult struct {
+	Hits          []*SearchHit
+	Total         int64
+	NextPageToken string // empty on the last page
+}
@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+type SummaryInterval string
+
+const (
+	IntervalDay   SummaryInterval = "day"
+	IntervalWeek  SummaryInterval = "week"
+	IntervalMonth SummaryInterval = "month"
+)
+
+// SpendingSummaryQuery aggregates the transactions of AccountID created in
+// [From, To), bucketed by Interval in TimeZone.
+type SpendingSummaryQuery struct {
+	AccountID         string
+	From              time.Time
+	To                time.Time
+	Interval          SummaryInterval
+	TimeZone          string // IANA name, e.g. "Asia/Jakarta"
+	TopCounterparties int
+}
+
+// Amounts below are in minor units of SpendingSummary.Currency.
+
+type SpendingBucket struct {
+	Start    time.Time
+	Incoming int64
+	Outgoing int64
+	Count    int64
+}
+
+type Counterparty struct {
+	AccountID string
+	Name      string
+	Amount    int64
+	Count     int64
+}
+
+type TypeBreakdown struct {
+	TransactionType TransactionType
+	Incoming        int64
+	Outgoing        int64
+	Count           int64
+}
+
+type SpendingSummary struct {
+	Currency      string
+	TotalIncoming int64
+	TotalOutgoing int64
+	Buckets       []SpendingBucket
+	// TopPayees received the most from the account, TopPayers sent it the most.
+	TopPayees []Counterparty
+	TopPayers []Counterparty
+	ByType    []TypeBreakdown
+}
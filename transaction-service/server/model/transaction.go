@@ -13,14 +13,52 @@ type Transaction struct {
 	ID              string
 	FromAccountID   string
 	ToAccountID     string
-	Amount          float64
+	Amount          int64 // minor units of Currency
+	Currency        string
 	TransactionType TransactionType
 	Notes           string
 	CreatedAt       time.Time
 }
 
+type Direction string
+
+const (
+	Incoming Direction = "incoming"
+	Outgoing Direction = "outgoing"
+)
+
+// HistoryCursor is the position of the last transaction on a history page.
+// History is ordered by CreatedAt then ID, both descending, so the next page
+// starts strictly after it.
+type HistoryCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+}
+
+// HistoryFilter narrows an account's history. Zero values do not filter.
+type HistoryFilter struct {
+	AccountID       string
+	TransactionType TransactionType
+	Direction       Direction
+	From            time.Time // inclusive
+	To              time.Time // exclusive
+	MinAmount       int64     // minor units, inclusive
+	MaxAmount       int64     // minor units, inclusive
+}
+
+type HistoryPage struct {
+	Transactions []*Transaction
+	Limit        int
+	// NextPageToken continues the history after the last transaction; empty
+	// on the last page.
+	NextPageToken string
+}
+
 type Account struct {
-	ID    string
-	Name  string
-	Email string
+	ID            string
+	Name          string
+	Email         string
+	EmailVerified bool
+	// UpdatedAt is when account-service last changed Name, Email or EmailVerified.
+	UpdatedAt time.Time
 }
@@ -0,0 +1,107 @@
+// Package money represents monetary amounts as integer minor units of an
+// ISO 4217 currency, so balances never pass through binary floating point.
+package money
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/apperr"
+)
+
+// DefaultCurrency is used for wallets and for legacy requests that only carry a
+// decimal amount.
+const DefaultCurrency = "IDR"
+
+// exponents holds the number of minor-unit digits for each supported currency.
+var exponents = map[string]int{
+	"IDR": 2,
+	"SGD": 2,
+	"MYR": 2,
+	"USD": 2,
+	"EUR": 2,
+	"JPY": 0,
+}
+
+var (
+	ErrUnsupportedCurrency = apperr.New(apperr.ErrInvalidArgument, "UNSUPPORTED_CURRENCY", "unsupported currency")
+	ErrInvalidDecimal      = apperr.New(apperr.ErrInvalidArgument, "INVALID_AMOUNT", "invalid decimal amount")
+)
+
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New returns an amount expressed in minor units of currency.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// Exponent returns the number of minor-unit digits of currency.
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[strings.ToUpper(currency)]
+	if !ok {
+		return 0, ErrUnsupportedCurrency.Withf("%q", currency)
+	}
+	return exp, nil
+}
+
+// ParseDecimal converts a decimal string such as "10000.50" into minor units of
+// currency. It rejects more fractional digits than the currency allows rather
+// than silently rounding.
+func ParseDecimal(s, currency string) (Money, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return Money{}, ErrInvalidDecimal.Withf("%q", s)
+	}
+	if len(frac) > exp {
+		return Money{}, ErrInvalidDecimal.Withf("%q has more than %d decimal places", s, exp)
+	}
+	digits := whole + frac + strings.Repeat("0", exp-len(frac))
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return Money{}, ErrInvalidDecimal.Withf("%q", s)
+		}
+	}
+
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, ErrInvalidDecimal.Withf("%q", s)
+	}
+	if negative {
+		amount = -amount
+	}
+	return New(amount, currency), nil
+}
+
+// Decimal formats m as a decimal string in major units, e.g. "10000.50".
+func (m Money) Decimal() string {
+	exp, err := Exponent(m.Currency)
+	if err != nil || exp == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign := ""
+	amount := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		amount = uint64(-m.Amount)
+	}
+	digits := fmt.Sprintf("%0*d", exp+1, amount)
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
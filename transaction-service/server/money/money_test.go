@@ -0,0 +1,98 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{name: "whole", input: "10000", currency: "IDR", want: Money{Amount: 1000000, Currency: "IDR"}},
+		{name: "fraction", input: "10000.50", currency: "IDR", want: Money{Amount: 1000050, Currency: "IDR"}},
+		{name: "short fraction", input: "0.5", currency: "USD", want: Money{Amount: 50, Currency: "USD"}},
+		{name: "no whole part", input: ".25", currency: "USD", want: Money{Amount: 25, Currency: "USD"}},
+		{name: "no minor units", input: "500", currency: "JPY", want: Money{Amount: 500, Currency: "JPY"}},
+		{name: "lower-case currency", input: "1", currency: "sgd", want: Money{Amount: 100, Currency: "SGD"}},
+		{name: "surrounding space", input: " 1.10 ", currency: "EUR", want: Money{Amount: 110, Currency: "EUR"}},
+		{name: "plus sign", input: "+2", currency: "IDR", want: Money{Amount: 200, Currency: "IDR"}},
+		{name: "negative", input: "-2.05", currency: "IDR", want: Money{Amount: -205, Currency: "IDR"}},
+		{name: "too many decimals", input: "0.001", currency: "USD", wantErr: ErrInvalidDecimal},
+		{name: "decimals for JPY", input: "1.5", currency: "JPY", wantErr: ErrInvalidDecimal},
+		{name: "empty", input: "", currency: "IDR", wantErr: ErrInvalidDecimal},
+		{name: "only a point", input: ".", currency: "IDR", wantErr: ErrInvalidDecimal},
+		{name: "letters", input: "1e3", currency: "IDR", wantErr: ErrInvalidDecimal},
+		{name: "two points", input: "1.2.3", currency: "IDR", wantErr: ErrInvalidDecimal},
+		{name: "overflow", input: "92233720368547758.08", currency: "IDR", wantErr: ErrInvalidDecimal},
+		{name: "unsupported currency", input: "1", currency: "XYZ", wantErr: ErrUnsupportedCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDecimal(tt.input, tt.currency)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseDecimal(%q, %q) error = %v, want %v", tt.input, tt.currency, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDecimal(%q, %q) error = %v", tt.input, tt.currency, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDecimal(%q, %q) = %+v, want %+v", tt.input, tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		name  string
+		money Money
+		want  string
+	}{
+		{name: "whole", money: New(1000000, "IDR"), want: "10000.00"},
+		{name: "fraction", money: New(1000050, "IDR"), want: "10000.50"},
+		{name: "less than one", money: New(5, "USD"), want: "0.05"},
+		{name: "zero", money: New(0, "USD"), want: "0.00"},
+		{name: "negative", money: New(-205, "IDR"), want: "-2.05"},
+		{name: "no minor units", money: New(500, "JPY"), want: "500"},
+		{name: "unsupported currency", money: New(123, "XYZ"), want: "123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.money.Decimal(); got != tt.want {
+				t.Errorf("%+v.Decimal() = %q, want %q", tt.money, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalRoundTrip(t *testing.T) {
+	tests := []Money{
+		New(1, "IDR"),
+		New(99, "USD"),
+		New(1000050, "IDR"),
+		New(-205, "EUR"),
+		New(123456789, "JPY"),
+	}
+
+	for _, m := range tests {
+		t.Run(m.String(), func(t *testing.T) {
+			got, err := ParseDecimal(m.Decimal(), m.Currency)
+			if err != nil {
+				t.Fatalf("ParseDecimal(%q) error = %v", m.Decimal(), err)
+			}
+			if got != m {
+				t.Errorf("round trip of %+v = %+v", m, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeResult is what a fakeDB answers to one statement: rows for a query,
+// affected rows for an exec.
+type fakeResult struct {
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+	err      error
+}
+
+// fakeStatement is a statement the repository ran against a fakeDB.
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeDB is a database/sql driver that answers every statement with respond
+// and records what was run, so repository code can be tested without
+// Postgres.
+type fakeDB struct {
+	respond func(query string, args []driver.Value) fakeResult
+
+	mu         sync.Mutex
+	statements []fakeStatement
+	committed  bool
+	rolledBack bool
+}
+
+func newFakeDB(t *testing.T, respond func(query string, args []driver.Value) fakeResult) (*fakeDB, *sql.DB) {
+	t.Helper()
+	fake := &fakeDB{respond: respond}
+	db := sql.OpenDB(fakeConnector{fake: fake})
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return fake, db
+}
+
+// find returns the recorded statements whose query contains substr.
+func (f *fakeDB) find(substr string) []fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var found []fakeStatement
+	for _, s := range f.statements {
+		if strings.Contains(s.query, substr) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+func (f *fakeDB) run(query string, named []driver.NamedValue) fakeResult {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+
+	f.mu.Lock()
+	f.statements = append(f.statements, fakeStatement{query: query, args: args})
+	f.mu.Unlock()
+
+	return f.respond(query, args)
+}
+
+type fakeConnector struct {
+	fake *fakeDB
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{fake: c.fake}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fakeDriver: use sql.OpenDB with a fakeConnector")
+}
+
+type fakeConn struct {
+	fake *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakeConn: prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{fake: c.fake}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result := c.fake.run(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return driver.RowsAffected(result.affected), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result := c.fake.run(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &fakeRows{columns: result.columns, rows: result.rows}, nil
+}
+
+type fakeTx struct {
+	fake *fakeDB
+}
+
+func (t *fakeTx) Commit() error {
+	t.fake.mu.Lock()
+	defer t.fake.mu.Unlock()
+	t.fake.committed = true
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.fake.mu.Lock()
+	defer t.fake.mu.Unlock()
+	t.fake.rolledBack = true
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
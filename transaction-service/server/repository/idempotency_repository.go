@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/apperr"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+var ErrIdempotencyKeyReused = apperr.New(apperr.ErrInvalidArgument, "IDEMPOTENCY_KEY_REUSED", "idempotency key was already used with a different request")
+
+// claimIdempotencyKey reserves key inside dbTx. It returns nil when the key is
+// new, so the caller should go on and record its transaction, or the original
+// transaction when the same request was already processed. A concurrent request
+// with the same key blocks on the insert until the first one commits or rolls back.
+func claimIdempotencyKey(ctx context.Context, dbTx *sql.Tx, key *model.IdempotencyKey) (*model.Transaction, error) {
+	_, err := dbTx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE account_id = $1 AND key = $2 AND expires_at <= $3`,
+		key.AccountID, key.Key, key.CreatedAt)
+	if err != nil {
+		log.Printf("Error deleting expired idempotency key: %v", err)
+		return nil, err
+	}
+
+	query := `INSERT INTO idempotency_keys (account_id, key, request_hash, transaction_id, created_at, expires_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  ON CONFLICT (account_id, key) DO NOTHING`
+	result, err := dbTx.ExecContext(ctx, query, key.AccountID, key.Key, key.RequestHash, key.TransactionID, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		log.Printf("Error inserting idempotency key: %v", err)
+		return nil, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		log.Printf("Error reading affected rows: %v", err)
+		return nil, err
+	}
+	if inserted == 1 {
+		return nil, nil
+	}
+
+	var requestHash, transactionID string
+	err = dbTx.QueryRowContext(ctx, `SELECT request_hash, transaction_id FROM idempotency_keys WHERE account_id = $1 AND key = $2`,
+		key.AccountID, key.Key).Scan(&requestHash, &transactionID)
+	if err != nil {
+		log.Printf("Error reading idempotency key: %v", err)
+		return nil, err
+	}
+	if requestHash != key.RequestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	return findTransactionByID(ctx, dbTx, transactionID)
+}
+
+func findTransactionByID(ctx context.Context, dbTx *sql.Tx, id string) (*model.Transaction, error) {
+	query := `SELECT id, COALESCE(from_account_id, ''), to_account_id, amount, currency, transaction_type, notes, created_at 
+			  FROM transactions 
+			  WHERE id = $1`
+	tx := &model.Transaction{}
+	err := dbTx.QueryRowContext(ctx, query, id).Scan(&tx.ID, &tx.FromAccountID, &tx.ToAccountID, &tx.Amount, &tx.Currency, &tx.TransactionType, &tx.Notes, &tx.CreatedAt)
+	if err != nil {
+		log.Printf("Error reading transaction: %v", err)
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (t transactionRepository) PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	result, err := t.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		log.Printf("Error purging expired idempotency keys: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+// idempotencyDB answers the statements of Topup and Transfer as walletDB does,
+// except that, when storedHash is not empty, the idempotency key is already
+// stored with storedHash for the original transaction.
+func idempotencyDB(t *testing.T, storedHash string, original *model.Transaction) (*fakeDB, TransactionRepository) {
+	wallets := walletResponder(map[string]int64{"acc-a": 10000, "acc-b": 0})
+	fake, db := newFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.Contains(query, "INSERT INTO idempotency_keys"):
+			if storedHash != "" {
+				return fakeResult{affected: 0}
+			}
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "SELECT request_hash, transaction_id FROM idempotency_keys"):
+			return fakeResult{
+				columns: []string{"request_hash", "transaction_id"},
+				rows:    [][]driver.Value{{storedHash, original.ID}},
+			}
+		case strings.Contains(query, "FROM transactions"):
+			return fakeResult{
+				columns: []string{"id", "from_account_id", "to_account_id", "amount", "currency", "transaction_type", "notes", "created_at"},
+				rows: [][]driver.Value{{original.ID, original.FromAccountID, original.ToAccountID, original.Amount,
+					original.Currency, string(original.TransactionType), original.Notes, original.CreatedAt}},
+			}
+		default:
+			return wallets(query, args)
+		}
+	})
+	return fake, NewTransactionRepository(db)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	firstAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	retryAt := firstAt.Add(time.Minute)
+
+	type operation struct {
+		name     string
+		original *model.Transaction
+		retry    *model.Transaction
+		run      func(repo TransactionRepository, tx *model.Transaction, key *model.IdempotencyKey) (*model.Transaction, error)
+	}
+	operations := []operation{
+		{
+			name: "topup",
+			original: &model.Transaction{ID: "tx-original", ToAccountID: "acc-a", Amount: 5000, Currency: "IDR",
+				TransactionType: model.Topup, Notes: "Topup", CreatedAt: firstAt},
+			retry: &model.Transaction{ID: "tx-retry", ToAccountID: "acc-a", Amount: 5000, Currency: "IDR",
+				TransactionType: model.Topup, Notes: "Topup", CreatedAt: retryAt},
+			run: func(repo TransactionRepository, tx *model.Transaction, key *model.IdempotencyKey) (*model.Transaction, error) {
+				return repo.Topup(context.Background(), tx, key)
+			},
+		},
+		{
+			name: "transfer",
+			original: &model.Transaction{ID: "tx-original", FromAccountID: "acc-a", ToAccountID: "acc-b", Amount: 2500,
+				Currency: "IDR", TransactionType: model.Transfer, Notes: "Transfer", CreatedAt: firstAt},
+			retry: &model.Transaction{ID: "tx-retry", FromAccountID: "acc-a", ToAccountID: "acc-b", Amount: 2500,
+				Currency: "IDR", TransactionType: model.Transfer, Notes: "Transfer", CreatedAt: retryAt},
+			run: func(repo TransactionRepository, tx *model.Transaction, key *model.IdempotencyKey) (*model.Transaction, error) {
+				return repo.Transfer(context.Background(), tx, key)
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		storedHash string
+		wantErr    error
+		wantReplay bool
+	}{
+		{name: "new key", storedHash: ""},
+		{name: "replay", storedHash: "hash-1", wantReplay: true},
+		{name: "reused with another request", storedHash: "hash-2", wantErr: ErrIdempotencyKeyReused},
+	}
+
+	for _, op := range operations {
+		for _, tt := range tests {
+			t.Run(op.name+"/"+tt.name, func(t *testing.T) {
+				fake, repo := idempotencyDB(t, tt.storedHash, op.original)
+
+				key := &model.IdempotencyKey{
+					Key:           "key-1",
+					AccountID:     "acc-a",
+					RequestHash:   "hash-1",
+					TransactionID: op.retry.ID,
+					CreatedAt:     retryAt,
+					ExpiresAt:     retryAt.Add(24 * time.Hour),
+				}
+				got, err := op.run(repo, op.retry, key)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				if tt.wantErr != nil {
+					if fake.committed {
+						t.Error("rejected request was committed")
+					}
+					return
+				}
+
+				writes := len(fake.find("UPDATE accounts SET balance")) + len(fake.find("INSERT INTO transactions"))
+				if !tt.wantReplay {
+					if got != op.retry {
+						t.Errorf("got %+v, want the new transaction", got)
+					}
+					if writes == 0 {
+						t.Error("new request was not recorded")
+					}
+					return
+				}
+				if *got != *op.original {
+					t.Errorf("replay returned %+v, want the original %+v", got, op.original)
+				}
+				if writes != 0 {
+					t.Errorf("replay moved money again: %+v", fake.statements)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+// IndexOutboxRepository tracks transactions that still have to be indexed in
+// Elasticsearch.
+type IndexOutboxRepository interface {
+	ProcessPending(ctx context.Context, limit int, index func(ctx context.Context, docs []*model.TransactionDocument) (map[string]error, error)) (*IndexBatch, error)
+	OldestPending(ctx context.Context) (time.Time, bool, error)
+}
+
+// IndexBatch is what one ProcessPending call did.
+type IndexBatch struct {
+	// Fetched counts the due rows the batch locked, whatever became of them.
+	Fetched int
+	Indexed int
+}
+
+const (
+	indexRetryBaseDelay = "1 second"
+	indexRetryMaxDelay  = "5 minutes"
+)
+
+type indexOutboxRepository struct {
+	db *sql.DB
+}
+
+func NewIndexOutboxRepository(db *sql.DB) IndexOutboxRepository {
+	return &indexOutboxRepository{db: db}
+}
+
+func insertIndexOutbox(ctx context.Context, dbTx *sql.Tx, transactionID string) error {
+	_, err := dbTx.ExecContext(ctx, `INSERT INTO search_index_outbox (transaction_id) VALUES ($1)`, transactionID)
+	if err != nil {
+		log.Printf("Error inserting search index outbox row: %v", err)
+	}
+	return err
+}
+
+// ProcessPending locks up to limit rows that are due, loads their transactions
+// and hands them to index in one call. Rows whose document was indexed, or
+// whose transaction no longer exists, are deleted; the others are retried
+// with exponential backoff. index returns per-document failures by
+// transaction ID, or an error when the whole batch failed. Rows locked by
+// another indexer are skipped.
+func (o indexOutboxRepository) ProcessPending(ctx context.Context, limit int, index func(ctx context.Context, docs []*model.TransactionDocument) (map[string]error, error)) (*IndexBatch, error) {
+	dbTx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting search index outbox transaction: %v", err)
+		return &IndexBatch{}, err
+	}
+	defer func(dbTx *sql.Tx) {
+		err := dbTx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Error rolling back search index outbox transaction: %v", err)
+		}
+	}(dbTx)
+
+	query := `SELECT id, transaction_id
+			  FROM search_index_outbox
+			  WHERE next_attempt_at <= NOW()
+			  ORDER BY id
+			  LIMIT $1
+			  FOR UPDATE SKIP LOCKED`
+	rows, err := dbTx.QueryContext(ctx, query, limit)
+	if err != nil {
+		log.Printf("Error querying search index outbox: %v", err)
+		return &IndexBatch{}, err
+	}
+	rowIDs := make(map[string][]int64)
+	var transactionIDs []string
+	fetched := 0
+	for rows.Next() {
+		var id int64
+		var transactionID string
+		if err := rows.Scan(&id, &transactionID); err != nil {
+			_ = rows.Close()
+			log.Printf("Error scanning search index outbox row: %v", err)
+			return &IndexBatch{}, err
+		}
+		if _, ok := rowIDs[transactionID]; !ok {
+			transactionIDs = append(transactionIDs, transactionID)
+		}
+		rowIDs[transactionID] = append(rowIDs[transactionID], id)
+		fetched++
+	}
+	if err := rows.Close(); err != nil {
+		log.Printf("Error closing rows: %v", err)
+		return &IndexBatch{}, err
+	}
+	if len(transactionIDs) == 0 {
+		return &IndexBatch{}, nil
+	}
+
+	docs, err := findDocumentsByID(ctx, dbTx, transactionIDs)
+	if err != nil {
+		return &IndexBatch{}, err
+	}
+
+	failures, indexErr := index(ctx, docs)
+	if indexErr != nil {
+		failures = make(map[string]error, len(docs))
+		for _, doc := range docs {
+			failures[doc.ID] = indexErr
+		}
+	}
+
+	var done []int64
+	for _, transactionID := range transactionIDs {
+		if failure, ok := failures[transactionID]; ok {
+			_, err := dbTx.ExecContext(ctx, `UPDATE search_index_outbox
+				  SET attempts = attempts + 1,
+				      last_error = $1,
+				      next_attempt_at = NOW() + LEAST(INTERVAL '`+indexRetryBaseDelay+`' * POWER(2, attempts), INTERVAL '`+indexRetryMaxDelay+`')
+				  WHERE id = ANY($2)`, failure.Error(), pq.Array(rowIDs[transactionID]))
+			if err != nil {
+				log.Printf("Error recording search index failure: %v", err)
+				return &IndexBatch{}, err
+			}
+			continue
+		}
+		done = append(done, rowIDs[transactionID]...)
+	}
+	if _, err := dbTx.ExecContext(ctx, `DELETE FROM search_index_outbox WHERE id = ANY($1)`, pq.Array(done)); err != nil {
+		log.Printf("Error deleting search index outbox rows: %v", err)
+		return &IndexBatch{}, err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		log.Printf("Error committing search index outbox transaction: %v", err)
+		return &IndexBatch{}, err
+	}
+	batch := &IndexBatch{Fetched: fetched}
+	if indexErr != nil {
+		return batch, indexErr
+	}
+	batch.Indexed = len(transactionIDs) - len(failures)
+	return batch, nil
+}
+
+// OldestPending returns when the oldest row still waiting to be indexed was
+// written, and false when nothing is pending.
+func (o indexOutboxRepository) OldestPending(ctx context.Context) (time.Time, bool, error) {
+	var oldest sql.NullTime
+	if err := o.db.QueryRowContext(ctx, `SELECT MIN(created_at) FROM search_index_outbox`).Scan(&oldest); err != nil {
+		log.Printf("Error querying oldest search index outbox row: %v", err)
+		return time.Time{}, false, err
+	}
+	return oldest.Time, oldest.Valid, nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+// indexOutboxDB answers ProcessPending with four due rows: two for tx-a, one
+// for tx-b and one for tx-c, whose transaction no longer exists.
+func indexOutboxDB(t *testing.T) (*fakeDB, IndexOutboxRepository) {
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake, db := newFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.Contains(query, "FROM search_index_outbox"):
+			return fakeResult{
+				columns: []string{"id", "transaction_id"},
+				rows:    [][]driver.Value{{int64(1), "tx-a"}, {int64(2), "tx-a"}, {int64(3), "tx-b"}, {int64(4), "tx-c"}},
+			}
+		case strings.Contains(query, "FROM transactions"):
+			return fakeResult{
+				columns: []string{"id", "from_account_id", "from_name", "to_account_id", "to_name", "amount", "currency", "transaction_type", "notes", "created_at"},
+				rows: [][]driver.Value{
+					{"tx-a", "", "", "acc-a", "Ana", int64(5000), "IDR", "topup", "Topup", createdAt},
+					{"tx-b", "acc-a", "Ana", "acc-b", "Budi", int64(1000), "IDR", "transfer", "Transfer", createdAt},
+				},
+			}
+		default:
+			return fakeResult{affected: 1}
+		}
+	})
+	return fake, NewIndexOutboxRepository(db)
+}
+
+func TestProcessPendingIndex(t *testing.T) {
+	errUnavailable := errors.New("elasticsearch unavailable")
+
+	tests := []struct {
+		name     string
+		failures map[string]error
+		indexErr error
+		// wantRetried and wantDeleted are the outbox row IDs put back for a
+		// retry and deleted, as Postgres arrays.
+		wantRetried []string
+		wantDeleted string
+		wantIndexed int
+		wantErr     error
+	}{
+		{
+			name:        "indexed",
+			wantDeleted: "{1,2,3,4}",
+			wantIndexed: 3,
+		},
+		{
+			name:        "document failed",
+			failures:    map[string]error{"tx-b": errors.New("mapper_parsing_exception")},
+			wantRetried: []string{"{3}"},
+			wantDeleted: "{1,2,4}",
+			wantIndexed: 2,
+		},
+		{
+			name:        "batch failed",
+			indexErr:    errUnavailable,
+			wantRetried: []string{"{1,2}", "{3}"},
+			wantDeleted: "{4}",
+			wantErr:     errUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, repo := indexOutboxDB(t)
+			var indexedDocs []string
+
+			batch, err := repo.ProcessPending(context.Background(), 4, func(_ context.Context, docs []*model.TransactionDocument) (map[string]error, error) {
+				for _, doc := range docs {
+					indexedDocs = append(indexedDocs, doc.ID)
+				}
+				return tt.failures, tt.indexErr
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ProcessPending() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// Rows of one transaction are counted once each, so a full batch
+			// is recognised as full.
+			if batch.Fetched != 4 || batch.Indexed != tt.wantIndexed {
+				t.Errorf("batch = %+v, want 4 fetched and %d indexed", batch, tt.wantIndexed)
+			}
+			if want := []string{"tx-a", "tx-b"}; !reflect.DeepEqual(indexedDocs, want) {
+				t.Errorf("indexed documents %v, want %v", indexedDocs, want)
+			}
+			var retried []string
+			for _, s := range fake.find("UPDATE search_index_outbox") {
+				retried = append(retried, s.args[1].(string))
+			}
+			if !reflect.DeepEqual(retried, tt.wantRetried) {
+				t.Errorf("retried rows %v, want %v", retried, tt.wantRetried)
+			}
+			deletes := fake.find("DELETE FROM search_index_outbox")
+			if len(deletes) != 1 || deletes[0].args[0] != tt.wantDeleted {
+				t.Errorf("deletes = %+v, want rows %s", deletes, tt.wantDeleted)
+			}
+			if !fake.committed {
+				t.Error("outbox changes were not committed")
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+// esIndexName is the alias every read and write of transaction documents goes through.
+const esIndexName = "transactions"
+
+// IndexRepository manages the versioned Elasticsearch indexes behind the
+// transactions alias that the service reads and writes through.
+type IndexRepository interface {
+	EnsureIndex(ctx context.Context) error
+	CreateVersionedIndex(ctx context.Context) (string, error)
+	BulkIndex(ctx context.Context, index string, docs []*model.TransactionDocument) (map[string]error, error)
+	IndexDocuments(ctx context.Context, docs []*model.TransactionDocument) (map[string]error, error)
+	FinishBulkIndexing(ctx context.Context, index string) error
+	SwapAlias(ctx context.Context, index string) ([]string, error)
+	GetDocuments(ctx context.Context, ids []string) (map[string]*model.TransactionDocument, error)
+	CountDocuments(ctx context.Context) (int64, error)
+}
+
+// transactionIndexMapping maps model.TransactionDocument. IDs and enumerations
+// are keywords for exact filters; notes and names are analyzed for free text.
+const transactionIndexMapping = `{
+	"mappings": {
+		"dynamic": "strict",
+		"properties": {
+			"id":                {"type": "keyword"},
+			"from_account_id":   {"type": "keyword"},
+			"from_account_name": {"type": "text"},
+			"to_account_id":     {"type": "keyword"},
+			"to_account_name":   {"type": "text"},
+			"amount":            {"type": "long"},
+			"currency":          {"type": "keyword"},
+			"transaction_type":  {"type": "keyword"},
+			"notes":             {"type": "text"},
+			"created_at":        {"type": "date"}
+		}
+	}
+}`
+
+type indexRepository struct {
+	es *elastic.Client
+}
+
+func NewIndexRepository(es *elastic.Client) IndexRepository {
+	return &indexRepository{es: es}
+}
+
+// EnsureIndex creates a versioned index behind the transactions alias if
+// neither the alias nor an index of that name exists yet.
+func (i indexRepository) EnsureIndex(ctx context.Context) error {
+	exists, err := i.es.IndexExists(esIndexName).Do(ctx)
+	if err != nil {
+		log.Printf("Error checking Elasticsearch index: %v", err)
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	index, err := i.createIndex(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = i.SwapAlias(ctx, index)
+	return err
+}
+
+// CreateVersionedIndex creates an index for a reindex with refreshes disabled,
+// which makes bulk indexing considerably faster.
+func (i indexRepository) CreateVersionedIndex(ctx context.Context) (string, error) {
+	return i.createIndex(ctx, map[string]interface{}{"refresh_interval": "-1"})
+}
+
+func (i indexRepository) createIndex(ctx context.Context, settings map[string]interface{}) (string, error) {
+	index := fmt.Sprintf("%s_v%s", esIndexName, time.Now().UTC().Format("20060102150405"))
+	if _, err := i.es.CreateIndex(index).BodyString(transactionIndexMapping).Do(ctx); err != nil {
+		log.Printf("Error creating Elasticsearch index: %v", err)
+		return "", err
+	}
+	if len(settings) > 0 {
+		if _, err := i.es.IndexPutSettings(index).BodyJson(settings).Do(ctx); err != nil {
+			log.Printf("Error updating Elasticsearch index settings: %v", err)
+			return "", err
+		}
+	}
+	return index, nil
+}
+
+// BulkIndex indexes docs into index in one request. It returns the failures
+// of individual documents by ID, or an error when the request itself failed.
+func (i indexRepository) BulkIndex(ctx context.Context, index string, docs []*model.TransactionDocument) (map[string]error, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	bulk := i.es.Bulk().Index(index)
+	for _, doc := range docs {
+		bulk.Add(elastic.NewBulkIndexRequest().Id(doc.ID).Doc(doc))
+	}
+	resp, err := bulk.Do(ctx)
+	if err != nil {
+		log.Printf("Error bulk indexing transactions: %v", err)
+		return nil, err
+	}
+
+	failures := make(map[string]error)
+	for _, item := range resp.Failed() {
+		reason := "unknown error"
+		if item.Error != nil {
+			reason = item.Error.Type + ": " + item.Error.Reason
+		}
+		log.Printf("Error indexing transaction %s: %s", item.Id, reason)
+		failures[item.Id] = errors.New(reason)
+	}
+	return failures, nil
+}
+
+// IndexDocuments indexes docs through the transactions alias.
+func (i indexRepository) IndexDocuments(ctx context.Context, docs []*model.TransactionDocument) (map[string]error, error) {
+	return i.BulkIndex(ctx, esIndexName, docs)
+}
+
+// FinishBulkIndexing restores periodic refreshes and makes everything indexed
+// so far searchable.
+func (i indexRepository) FinishBulkIndexing(ctx context.Context, index string) error {
+	if _, err := i.es.IndexPutSettings(index).BodyString(`{"refresh_interval": null}`).Do(ctx); err != nil {
+		log.Printf("Error updating Elasticsearch index settings: %v", err)
+		return err
+	}
+	if _, err := i.es.Refresh(index).Do(ctx); err != nil {
+		log.Printf("Error refreshing Elasticsearch index: %v", err)
+		return err
+	}
+	return nil
+}
+
+// SwapAlias points the transactions alias at index in one atomic request and
+// returns the indexes it pointed at before. A concrete index still using the
+// alias name, from before indexes were versioned, is deleted in the same request.
+func (i indexRepository) SwapAlias(ctx context.Context, index string) ([]string, error) {
+	var previous []string
+	aliases, err := i.es.Aliases().Index(esIndexName).Do(ctx)
+	if err != nil && !elastic.IsNotFound(err) {
+		log.Printf("Error reading Elasticsearch aliases: %v", err)
+		return nil, err
+	}
+
+	actions := []elastic.AliasAction{elastic.NewAliasAddAction(esIndexName).Index(index)}
+	if aliases != nil {
+		for name := range aliases.Indices {
+			switch {
+			case name == index:
+			case name == esIndexName:
+				actions = append(actions, elastic.NewAliasRemoveIndexAction(name))
+			default:
+				actions = append(actions, elastic.NewAliasRemoveAction(esIndexName).Index(name))
+				previous = append(previous, name)
+			}
+		}
+	}
+
+	if _, err := i.es.Alias().Action(actions...).Do(ctx); err != nil {
+		log.Printf("Error swapping Elasticsearch alias: %v", err)
+		return nil, err
+	}
+	return previous, nil
+}
+
+// GetDocuments fetches the documents with ids through the alias; missing ids
+// are absent from the result.
+func (i indexRepository) GetDocuments(ctx context.Context, ids []string) (map[string]*model.TransactionDocument, error) {
+	docs := make(map[string]*model.TransactionDocument, len(ids))
+	if len(ids) == 0 {
+		return docs, nil
+	}
+
+	mget := i.es.Mget()
+	for _, id := range ids {
+		mget.Add(elastic.NewMultiGetItem().Index(esIndexName).Id(id))
+	}
+	resp, err := mget.Do(ctx)
+	if err != nil {
+		log.Printf("Error fetching transaction documents: %v", err)
+		return nil, err
+	}
+
+	for _, item := range resp.Docs {
+		if !item.Found {
+			continue
+		}
+		doc := &model.TransactionDocument{}
+		if err := json.Unmarshal(item.Source, doc); err != nil {
+			log.Printf("Error decoding transaction document: %v", err)
+			return nil, err
+		}
+		docs[item.Id] = doc
+	}
+	return docs, nil
+}
+
+func (i indexRepository) CountDocuments(ctx context.Context) (int64, error) {
+	count, err := i.es.Count(esIndexName).Do(ctx)
+	if err != nil {
+		log.Printf("Error counting transaction documents: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
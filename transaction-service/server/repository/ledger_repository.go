@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+var ErrUnbalancedEntry = errors.New("journal entry debits and credits do not balance")
+
+type LedgerRepository interface {
+	FindUnbalancedEntries(ctx context.Context) ([]string, error)
+	FindBalanceMismatches(ctx context.Context) ([]model.BalanceMismatch, error)
+	RebuildBalances(ctx context.Context) (int64, error)
+}
+
+// ledgerBalanceQuery sums postings into a credit-normal balance per account.
+const ledgerBalanceQuery = `SELECT account_id, currency,
+	SUM(CASE WHEN direction = 'credit' THEN amount ELSE -amount END) AS ledger_balance
+	FROM postings
+	GROUP BY account_id, currency`
+
+type ledgerRepository struct {
+	db *sql.DB
+}
+
+func NewLedgerRepository(db *sql.DB) LedgerRepository {
+	return &ledgerRepository{db: db}
+}
+
+func (l ledgerRepository) FindUnbalancedEntries(ctx context.Context) ([]string, error) {
+	// An entry is reported once even if it is unbalanced in several currencies.
+	query := `SELECT journal_entry_id
+			  FROM (
+			      SELECT journal_entry_id, SUM(CASE WHEN direction = 'credit' THEN amount ELSE -amount END) AS net
+			      FROM postings
+			      GROUP BY journal_entry_id, currency
+			  ) per_currency
+			  GROUP BY journal_entry_id
+			  HAVING bool_or(net <> 0)
+			  ORDER BY journal_entry_id`
+	rows, err := l.db.QueryContext(ctx, query)
+	if err != nil {
+		log.Printf("Error querying unbalanced journal entries: %v", err)
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var entryIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("Error scanning journal entry: %v", err)
+			return nil, err
+		}
+		entryIDs = append(entryIDs, id)
+	}
+	return entryIDs, rows.Err()
+}
+
+func (l ledgerRepository) FindBalanceMismatches(ctx context.Context) ([]model.BalanceMismatch, error) {
+	query := `SELECT a.id, a.currency, a.balance, COALESCE(p.ledger_balance, 0)
+			  FROM accounts a
+			  LEFT JOIN (` + ledgerBalanceQuery + `) p ON p.account_id = a.id AND p.currency = a.currency
+			  WHERE a.balance <> COALESCE(p.ledger_balance, 0)
+			  ORDER BY a.id`
+	rows, err := l.db.QueryContext(ctx, query)
+	if err != nil {
+		log.Printf("Error querying balance mismatches: %v", err)
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var mismatches []model.BalanceMismatch
+	for rows.Next() {
+		var m model.BalanceMismatch
+		if err := rows.Scan(&m.AccountID, &m.Currency, &m.Balance, &m.LedgerBalance); err != nil {
+			log.Printf("Error scanning balance mismatch: %v", err)
+			return nil, err
+		}
+		mismatches = append(mismatches, m)
+	}
+	return mismatches, rows.Err()
+}
+
+// RebuildBalances overwrites every wallet balance with the sum of its postings
+// and returns the number of accounts that changed.
+func (l ledgerRepository) RebuildBalances(ctx context.Context) (int64, error) {
+	query := `UPDATE accounts a
+			  SET balance = COALESCE(p.ledger_balance, 0)
+			  FROM accounts src
+			  LEFT JOIN (` + ledgerBalanceQuery + `) p ON p.account_id = src.id AND p.currency = src.currency
+			  WHERE a.id = src.id AND a.balance <> COALESCE(p.ledger_balance, 0)`
+	result, err := l.db.ExecContext(ctx, query)
+	if err != nil {
+		log.Printf("Error rebuilding balances: %v", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// insertJournalEntry records entry and its postings inside dbTx, refusing
+// entries whose debits and credits do not balance.
+func insertJournalEntry(ctx context.Context, dbTx *sql.Tx, entry *model.JournalEntry) error {
+	if !entry.Balanced() {
+		return ErrUnbalancedEntry
+	}
+
+	query := `INSERT INTO journal_entries (transaction_id, created_at) VALUES ($1, $2) RETURNING id`
+	if err := dbTx.QueryRowContext(ctx, query, entry.TransactionID, entry.CreatedAt).Scan(&entry.ID); err != nil {
+		log.Printf("Error inserting journal entry: %v", err)
+		return err
+	}
+
+	postingQuery := `INSERT INTO postings (journal_entry_id, account_id, direction, amount, currency, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)`
+	for _, p := range entry.Postings {
+		_, err := dbTx.ExecContext(ctx, postingQuery, entry.ID, p.AccountID, p.Direction, p.Amount, p.Currency, entry.CreatedAt)
+		if err != nil {
+			log.Printf("Error inserting posting: %v", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+type SearchRepository interface {
+	SearchTransactions(ctx context.Context, q *model.SearchQuery) ([]*model.SearchHit, int64, error)
+	SpendingSummary(ctx context.Context, q *model.SpendingSummaryQuery) (*model.SpendingSummary, error)
+}
+
+var searchableFields = []string{"notes", "from_account_name", "to_account_name"}
+
+type searchRepository struct {
+	es *elastic.Client
+}
+
+func NewSearchRepository(es *elastic.Client) SearchRepository {
+	return &searchRepository{es: es}
+}
+
+func (s searchRepository) SearchTransactions(ctx context.Context, q *model.SearchQuery) ([]*model.SearchHit, int64, error) {
+	query := elastic.NewBoolQuery().Filter(searchFilters(q.Filter)...)
+	if q.Text != "" {
+		query = query.Must(elastic.NewMultiMatchQuery(q.Text, searchableFields...).Fuzziness("AUTO"))
+	}
+
+	highlight := elastic.NewHighlight().PreTags("<em>").PostTags("</em>")
+	for _, field := range searchableFields {
+		highlight = highlight.Fields(elastic.NewHighlighterField(field))
+	}
+
+	search := s.es.Search(esIndexName).
+		Query(query).
+		Highlight(highlight).
+		Size(q.Limit).
+		TrackTotalHits(true)
+	for _, sorter := range searchSorters(q.Sort) {
+		search = search.SortBy(sorter)
+	}
+	if len(q.SearchAfter) > 0 {
+		search = search.SearchAfter(q.SearchAfter...)
+	}
+
+	result, err := search.Do(ctx)
+	if err != nil {
+		log.Printf("Error searching transactions: %v", err)
+		return nil, 0, err
+	}
+
+	hits := make([]*model.SearchHit, 0, len(result.Hits.Hits))
+	for _, h := range result.Hits.Hits {
+		doc := &model.TransactionDocument{}
+		if err := json.Unmarshal(h.Source, doc); err != nil {
+			log.Printf("Error decoding transaction document: %v", err)
+			return nil, 0, err
+		}
+		hit := &model.SearchHit{
+			Transaction: doc,
+			Highlights:  h.Highlight,
+			SortValues:  h.Sort,
+		}
+		if h.Score != nil {
+			hit.Score = *h.Score
+		}
+		hits = append(hits, hit)
+	}
+	return hits, result.TotalHits(), nil
+}
+
+// searchFilters scopes the search to the account and applies the optional filters.
+func searchFilters(filter model.HistoryFilter) []elastic.Query {
+	var filters []elastic.Query
+	switch filter.Direction {
+	case model.Outgoing:
+		filters = append(filters, elastic.NewTermQuery("from_account_id", filter.AccountID))
+	case model.Incoming:
+		filters = append(filters, elastic.NewTermQuery("to_account_id", filter.AccountID))
+	default:
+		filters = append(filters, elastic.NewBoolQuery().
+			Should(
+				elastic.NewTermQuery("from_account_id", filter.AccountID),
+				elastic.NewTermQuery("to_account_id", filter.AccountID),
+			).
+			MinimumNumberShouldMatch(1))
+	}
+
+	if filter.TransactionType != "" {
+		filters = append(filters, elastic.NewTermQuery("transaction_type", string(filter.TransactionType)))
+	}
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		createdAt := elastic.NewRangeQuery("created_at")
+		if !filter.From.IsZero() {
+			createdAt = createdAt.Gte(filter.From)
+		}
+		if !filter.To.IsZero() {
+			createdAt = createdAt.Lt(filter.To)
+		}
+		filters = append(filters, createdAt)
+	}
+	if filter.MinAmount > 0 || filter.MaxAmount > 0 {
+		amount := elastic.NewRangeQuery("amount")
+		if filter.MinAmount > 0 {
+			amount = amount.Gte(filter.MinAmount)
+		}
+		if filter.MaxAmount > 0 {
+			amount = amount.Lte(filter.MaxAmount)
+		}
+		filters = append(filters, amount)
+	}
+	return filters
+}
+
+// searchSorters orders hits by sort, breaking ties by id so that search_after
+// pagination is stable.
+func searchSorters(sort model.SearchSort) []elastic.Sorter {
+	var primary elastic.Sorter
+	switch sort {
+	case model.SortNewest:
+		primary = elastic.NewFieldSort("created_at").Desc()
+	case model.SortOldest:
+		primary = elastic.NewFieldSort("created_at").Asc()
+	case model.SortAmountDesc:
+		primary = elastic.NewFieldSort("amount").Desc()
+	case model.SortAmountAsc:
+		primary = elastic.NewFieldSort("amount").Asc()
+	default:
+		primary = elastic.NewScoreSort()
+	}
+	return []elastic.Sorter{primary, elastic.NewFieldSort("id").Asc()}
+}
+
+// SpendingSummary aggregates the account's transactions in a single search
+// request that returns no hits, only aggregations.
+func (s searchRepository) SpendingSummary(ctx context.Context, q *model.SpendingSummaryQuery) (*model.SpendingSummary, error) {
+	query := elastic.NewBoolQuery().Filter(searchFilters(model.HistoryFilter{
+		AccountID: q.AccountID,
+		From:      q.From,
+		To:        q.To,
+	})...)
+
+	// Every breakdown sums incoming and outgoing amounts separately.
+	incoming, outgoing := flowAggregations(q.AccountID)
+	overTime := elastic.NewDateHistogramAggregation().
+		Field("created_at").
+		CalendarInterval(string(q.Interval)).
+		TimeZone(q.TimeZone).
+		MinDocCount(0).
+		ExtendedBounds(q.From.UnixMilli(), q.To.Add(-time.Millisecond).UnixMilli()).
+		SubAggregation("incoming", incoming).
+		SubAggregation("outgoing", outgoing)
+	byType := elastic.NewTermsAggregation().
+		Field("transaction_type").
+		Size(10).
+		SubAggregation("incoming", incoming).
+		SubAggregation("outgoing", outgoing)
+	totals := elastic.NewFilterAggregation().
+		Filter(elastic.NewMatchAllQuery()).
+		SubAggregation("incoming", incoming).
+		SubAggregation("outgoing", outgoing)
+
+	result, err := s.es.Search(esIndexName).
+		Query(query).
+		Size(0).
+		Aggregation("currency", elastic.NewTermsAggregation().Field("currency").Size(1)).
+		Aggregation("totals", totals).
+		Aggregation("over_time", overTime).
+		Aggregation("by_type", byType).
+		Aggregation("top_payees", counterpartyAggregation(q, "from_account_id", "to_account_id", "to_account_name")).
+		Aggregation("top_payers", counterpartyAggregation(q, "to_account_id", "from_account_id", "from_account_name")).
+		Do(ctx)
+	if err != nil {
+		log.Printf("Error aggregating transactions: %v", err)
+		return nil, err
+	}
+
+	summary := &model.SpendingSummary{}
+	aggs := result.Aggregations
+	if currency, ok := aggs.Terms("currency"); ok && len(currency.Buckets) > 0 {
+		summary.Currency, _ = currency.Buckets[0].Key.(string)
+	}
+	if totals, ok := aggs.Filter("totals"); ok {
+		summary.TotalIncoming, summary.TotalOutgoing = flows(totals.Aggregations)
+	}
+	if overTime, ok := aggs.DateHistogram("over_time"); ok {
+		for _, b := range overTime.Buckets {
+			bucket := model.SpendingBucket{
+				Start: time.UnixMilli(int64(b.Key)).UTC(),
+				Count: b.DocCount,
+			}
+			bucket.Incoming, bucket.Outgoing = flows(b.Aggregations)
+			summary.Buckets = append(summary.Buckets, bucket)
+		}
+	}
+	if byType, ok := aggs.Terms("by_type"); ok {
+		for _, b := range byType.Buckets {
+			breakdown := model.TypeBreakdown{Count: b.DocCount}
+			if key, ok := b.Key.(string); ok {
+				breakdown.TransactionType = model.TransactionType(key)
+			}
+			breakdown.Incoming, breakdown.Outgoing = flows(b.Aggregations)
+			summary.ByType = append(summary.ByType, breakdown)
+		}
+	}
+	summary.TopPayees, err = counterparties(aggs, "top_payees", "to_account_name")
+	if err != nil {
+		return nil, err
+	}
+	summary.TopPayers, err = counterparties(aggs, "top_payers", "from_account_name")
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+func flowAggregations(accountID string) (incoming, outgoing elastic.Aggregation) {
+	incoming = elastic.NewFilterAggregation().
+		Filter(elastic.NewTermQuery("to_account_id", accountID)).
+		SubAggregation("amount", elastic.NewSumAggregation().Field("amount"))
+	outgoing = elastic.NewFilterAggregation().
+		Filter(elastic.NewTermQuery("from_account_id", accountID)).
+		SubAggregation("amount", elastic.NewSumAggregation().Field("amount"))
+	return incoming, outgoing
+}
+
+// counterpartyAggregation ranks the other party of transactions where the
+// account is ownField by total amount, keeping one document for its name.
+// Topups have no payer, so transactions without an otherField are left out
+// rather than ranked as a blank party.
+func counterpartyAggregation(q *model.SpendingSummaryQuery, ownField, otherField, otherNameField string) elastic.Aggregation {
+	return elastic.NewFilterAggregation().
+		Filter(elastic.NewBoolQuery().
+			Filter(elastic.NewTermQuery(ownField, q.AccountID), elastic.NewExistsQuery(otherField)).
+			MustNot(elastic.NewTermQuery(otherField, ""))).
+		SubAggregation("parties", elastic.NewTermsAggregation().
+			Field(otherField).
+			Size(q.TopCounterparties).
+			OrderByAggregation("amount", false).
+			SubAggregation("amount", elastic.NewSumAggregation().Field("amount")).
+			SubAggregation("latest", elastic.NewTopHitsAggregation().
+				Size(1).
+				Sort("created_at", false).
+				FetchSourceContext(elastic.NewFetchSourceContext(true).Include(otherNameField))))
+}
+
+func counterparties(aggs elastic.Aggregations, name, nameField string) ([]model.Counterparty, error) {
+	filter, ok := aggs.Filter(name)
+	if !ok {
+		return nil, nil
+	}
+	parties, ok := filter.Aggregations.Terms("parties")
+	if !ok {
+		return nil, nil
+	}
+
+	result := make([]model.Counterparty, 0, len(parties.Buckets))
+	for _, b := range parties.Buckets {
+		party := model.Counterparty{Count: b.DocCount, Amount: sum(b.Aggregations, "amount")}
+		party.AccountID, _ = b.Key.(string)
+		if latest, ok := b.Aggregations.TopHits("latest"); ok && latest.Hits != nil && len(latest.Hits.Hits) > 0 {
+			var source map[string]string
+			if err := json.Unmarshal(latest.Hits.Hits[0].Source, &source); err != nil {
+				log.Printf("Error decoding counterparty name: %v", err)
+				return nil, err
+			}
+			party.Name = source[nameField]
+		}
+		result = append(result, party)
+	}
+	return result, nil
+}
+
+func flows(aggs elastic.Aggregations) (incoming, outgoing int64) {
+	if in, ok := aggs.Filter("incoming"); ok {
+		incoming = sum(in.Aggregations, "amount")
+	}
+	if out, ok := aggs.Filter("outgoing"); ok {
+		outgoing = sum(out.Aggregations, "amount")
+	}
+	return incoming, outgoing
+}
+
+func sum(aggs elastic.Aggregations, name string) int64 {
+	metric, ok := aggs.Sum(name)
+	if !ok || metric.Value == nil {
+		return 0
+	}
+	return int64(math.Round(*metric.Value))
+}
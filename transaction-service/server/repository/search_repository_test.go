@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+// fakeES answers every request with response and records the path and body of
+// the last one.
+type fakeES struct {
+	response string
+	path     string
+	body     map[string]interface{}
+}
+
+func newFakeES(t *testing.T, response string) (*fakeES, *elastic.Client) {
+	t.Helper()
+	fake := &fakeES{response: response}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.path = r.URL.Path
+		data, _ := io.ReadAll(r.Body)
+		fake.body = nil
+		_ = json.Unmarshal(data, &fake.body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, fake.response)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := elastic.NewSimpleClient(elastic.SetURL(server.URL))
+	if err != nil {
+		t.Fatalf("failed to create Elasticsearch client: %v", err)
+	}
+	return fake, client
+}
+
+const summaryResponse = `{
+  "took": 1,
+  "hits": {"total": {"value": 3, "relation": "eq"}, "hits": []},
+  "aggregations": {
+    "currency": {"buckets": [{"key": "IDR", "doc_count": 3}]},
+    "totals": {"doc_count": 3, "incoming": {"doc_count": 2, "amount": {"value": 15000}}, "outgoing": {"doc_count": 1, "amount": {"value": 2500}}},
+    "over_time": {"buckets": [
+      {"key": 1735689600000, "key_as_string": "2025-01-01", "doc_count": 2, "incoming": {"doc_count": 2, "amount": {"value": 15000}}, "outgoing": {"doc_count": 0, "amount": {"value": 0}}},
+      {"key": 1738368000000, "key_as_string": "2025-02-01", "doc_count": 1, "incoming": {"doc_count": 0, "amount": {"value": 0}}, "outgoing": {"doc_count": 1, "amount": {"value": 2500}}}
+    ]},
+    "by_type": {"buckets": [
+      {"key": "topup", "doc_count": 1, "incoming": {"doc_count": 1, "amount": {"value": 10000}}, "outgoing": {"doc_count": 0, "amount": {"value": 0}}},
+      {"key": "transfer", "doc_count": 2, "incoming": {"doc_count": 1, "amount": {"value": 5000}}, "outgoing": {"doc_count": 1, "amount": {"value": 2500}}}
+    ]},
+    "top_payees": {"doc_count": 1, "parties": {"buckets": [
+      {"key": "acc-c", "doc_count": 1, "amount": {"value": 2500},
+       "latest": {"hits": {"total": {"value": 1}, "hits": [{"_index": "transactions_v1", "_id": "tx-3", "_source": {"to_account_name": "Citra"}}]}}}
+    ]}},
+    "top_payers": {"doc_count": 1, "parties": {"buckets": [
+      {"key": "acc-b", "doc_count": 1, "amount": {"value": 5000},
+       "latest": {"hits": {"total": {"value": 1}, "hits": [{"_index": "transactions_v1", "_id": "tx-2", "_source": {"from_account_name": "Budi"}}]}}}
+    ]}}
+  }
+}`
+
+func TestSpendingSummary(t *testing.T) {
+	fake, client := newFakeES(t, summaryResponse)
+	repo := NewSearchRepository(client)
+	q := &model.SpendingSummaryQuery{
+		AccountID:         "acc-a",
+		From:              time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:                time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		Interval:          model.IntervalMonth,
+		TimeZone:          "Asia/Jakarta",
+		TopCounterparties: 5,
+	}
+
+	summary, err := repo.SpendingSummary(context.Background(), q)
+	if err != nil {
+		t.Fatalf("SpendingSummary() error = %v", err)
+	}
+
+	want := &model.SpendingSummary{
+		Currency:      "IDR",
+		TotalIncoming: 15000,
+		TotalOutgoing: 2500,
+		Buckets: []model.SpendingBucket{
+			{Start: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Incoming: 15000, Count: 2},
+			{Start: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), Outgoing: 2500, Count: 1},
+		},
+		TopPayees: []model.Counterparty{{AccountID: "acc-c", Name: "Citra", Amount: 2500, Count: 1}},
+		TopPayers: []model.Counterparty{{AccountID: "acc-b", Name: "Budi", Amount: 5000, Count: 1}},
+		ByType: []model.TypeBreakdown{
+			{TransactionType: model.Topup, Incoming: 10000, Count: 1},
+			{TransactionType: model.Transfer, Incoming: 5000, Outgoing: 2500, Count: 2},
+		},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("SpendingSummary() = %+v, want %+v", summary, want)
+	}
+
+	if !strings.HasPrefix(fake.path, "/"+esIndexName+"/_search") {
+		t.Errorf("searched %s, want the %s alias", fake.path, esIndexName)
+	}
+	if size, _ := fake.body["size"].(float64); size != 0 {
+		t.Errorf("search asked for %v hits, want none", fake.body["size"])
+	}
+	histogram, _ := fake.body["aggregations"].(map[string]interface{})["over_time"].(map[string]interface{})["date_histogram"].(map[string]interface{})
+	if histogram["calendar_interval"] != "month" || histogram["time_zone"] != "Asia/Jakarta" {
+		t.Errorf("date histogram = %v, want monthly buckets in Asia/Jakarta", histogram)
+	}
+}
+
+func TestSpendingSummaryWithoutTransactions(t *testing.T) {
+	_, client := newFakeES(t, `{"took": 1, "hits": {"total": {"value": 0}, "hits": []}, "aggregations": {
+	  "currency": {"buckets": []},
+	  "totals": {"doc_count": 0, "incoming": {"doc_count": 0, "amount": {"value": 0}}, "outgoing": {"doc_count": 0, "amount": {"value": 0}}},
+	  "over_time": {"buckets": []},
+	  "by_type": {"buckets": []},
+	  "top_payees": {"doc_count": 0, "parties": {"buckets": []}},
+	  "top_payers": {"doc_count": 0, "parties": {"buckets": []}}
+	}}`)
+	repo := NewSearchRepository(client)
+
+	summary, err := repo.SpendingSummary(context.Background(), &model.SpendingSummaryQuery{
+		AccountID: "acc-a",
+		From:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		Interval:  model.IntervalDay,
+		TimeZone:  "UTC",
+	})
+	if err != nil {
+		t.Fatalf("SpendingSummary() error = %v", err)
+	}
+	if summary.Currency != "" || summary.TotalIncoming != 0 || summary.TotalOutgoing != 0 || len(summary.TopPayees) != 0 || len(summary.TopPayers) != 0 {
+		t.Errorf("SpendingSummary() = %+v, want an empty summary", summary)
+	}
+}
@@ -3,29 +3,43 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"github.com/olivere/elastic/v7"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/apperr"
 	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
 	"log"
+	"sort"
+	"time"
 )
 
 type TransactionRepository interface {
 	CreateTransaction(ctx context.Context, tx *model.Transaction) error
-	FindHistoryByAccountID(ctx context.Context, accountID string, page, limit int) ([]*model.Transaction, int64, error)
+	FindHistory(ctx context.Context, filter model.HistoryFilter, after *model.HistoryCursor, limit int) ([]*model.Transaction, error)
 	CreateAccount(ctx context.Context, acc *model.Account) error
+	UpdateAccount(ctx context.Context, acc *model.Account) error
+	IsEmailVerified(ctx context.Context, id string) (bool, error)
+	CloseAccount(ctx context.Context, id string) error
+	Topup(ctx context.Context, tx *model.Transaction, key *model.IdempotencyKey) (*model.Transaction, error)
+	Transfer(ctx context.Context, tx *model.Transaction, key *model.IdempotencyKey) (*model.Transaction, error)
+	PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+	FindDocuments(ctx context.Context, after *model.HistoryCursor, limit int) ([]*model.TransactionDocument, error)
 }
 
-const esIndexName = "transactions"
+var (
+	ErrAccountNotFound   = apperr.New(apperr.ErrNotFound, "ACCOUNT_NOT_FOUND", "account not found")
+	ErrInsufficientFunds = apperr.New(apperr.ErrInsufficientFunds, "INSUFFICIENT_FUNDS", "insufficient funds")
+	ErrCurrencyMismatch  = apperr.New(apperr.ErrFailedPrecondition, "CURRENCY_MISMATCH", "currency does not match account currency")
+	ErrAccountClosed     = apperr.New(apperr.ErrFailedPrecondition, "ACCOUNT_CLOSED", "account is closed")
+	ErrBalanceNotZero    = apperr.New(apperr.ErrFailedPrecondition, "BALANCE_NOT_ZERO", "account balance must be zero to close it")
+)
 
 type transactionRepository struct {
 	db *sql.DB
-	es *elastic.Client
 }
 
-func NewTransactionRepository(db *sql.DB, es *elastic.Client) TransactionRepository {
-	return &transactionRepository{
-		db: db,
-		es: es,
-	}
+func NewTransactionRepository(db *sql.DB) TransactionRepository {
+	return &transactionRepository{db: db}
 }
 
 func (t transactionRepository) CreateAccount(ctx context.Context, acc *model.Account) error {
@@ -37,39 +51,339 @@ func (t transactionRepository) CreateAccount(ctx context.Context, acc *model.Acc
 	return err
 }
 
-func (t transactionRepository) CreateTransaction(ctx context.Context, tx *model.Transaction) error {
-	query := `INSERT INTO transactions (id, from_account_id, to_account_id, amount, transaction_type, notes, created_at) 
-			  VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	_, err := t.db.ExecContext(ctx, query, tx.ID, tx.FromAccountID, tx.ToAccountID, tx.Amount, tx.TransactionType, tx.Notes, tx.CreatedAt)
+// UpdateAccount copies a change of name, email or email verification made in
+// account-service. A
+// change older than the one already applied is ignored, and the account's
+// transactions are queued for reindexing when the name changed, since search
+// documents carry the names of both parties.
+func (t transactionRepository) UpdateAccount(ctx context.Context, acc *model.Account) error {
+	dbTx, err := t.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Error inserting transaction: %v", err)
+		log.Printf("Error starting account update transaction: %v", err)
+		return err
+	}
+	defer func(dbTx *sql.Tx) {
+		err := dbTx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Error rolling back account update transaction: %v", err)
+		}
+	}(dbTx)
+
+	var name string
+	var profileUpdatedAt sql.NullTime
+	err = dbTx.QueryRowContext(ctx, `SELECT name, profile_updated_at FROM accounts WHERE id = $1 FOR UPDATE`, acc.ID).Scan(&name, &profileUpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAccountNotFound
+		}
+		log.Printf("Error locking account: %v", err)
+		return err
+	}
+	if profileUpdatedAt.Valid && !acc.UpdatedAt.After(profileUpdatedAt.Time) {
+		return nil
+	}
+
+	query := `UPDATE accounts SET name = $1, email = $2, email_verified = $3, profile_updated_at = $4 WHERE id = $5`
+	if _, err := dbTx.ExecContext(ctx, query, acc.Name, acc.Email, acc.EmailVerified, acc.UpdatedAt, acc.ID); err != nil {
+		log.Printf("Error updating account: %v", err)
+		return err
+	}
+	if name != acc.Name {
+		query := `INSERT INTO search_index_outbox (transaction_id)
+				  SELECT id FROM transactions WHERE from_account_id = $1 OR to_account_id = $1`
+		if _, err := dbTx.ExecContext(ctx, query, acc.ID); err != nil {
+			log.Printf("Error queueing account transactions for reindexing: %v", err)
+			return err
+		}
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		log.Printf("Error committing account update transaction: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (t transactionRepository) IsEmailVerified(ctx context.Context, id string) (bool, error) {
+	var verified bool
+	err := t.db.QueryRowContext(ctx, `SELECT email_verified FROM accounts WHERE id = $1`, id).Scan(&verified)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrAccountNotFound
+		}
+		log.Printf("Error checking email verification: %v", err)
+		return false, err
+	}
+	return verified, nil
+}
+
+// CloseAccount closes an empty wallet. The row is locked so no topup or
+// transfer can change the balance between the check and the close. Closing a
+// closed wallet succeeds.
+func (t transactionRepository) CloseAccount(ctx context.Context, id string) error {
+	dbTx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting account close transaction: %v", err)
+		return err
+	}
+	defer func(dbTx *sql.Tx) {
+		err := dbTx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Error rolling back account close transaction: %v", err)
+		}
+	}(dbTx)
+
+	var balance int64
+	var closedAt sql.NullTime
+	err = dbTx.QueryRowContext(ctx, `SELECT balance, closed_at FROM accounts WHERE id = $1 FOR UPDATE`, id).Scan(&balance, &closedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAccountNotFound
+		}
+		log.Printf("Error locking account: %v", err)
 		return err
 	}
+	if closedAt.Valid {
+		return nil
+	}
+	if balance != 0 {
+		return ErrBalanceNotZero
+	}
 
-	// Index the transaction in Elasticsearch
-	_, err = t.es.Index().
-		Index(esIndexName).
-		Id(tx.ID).
-		BodyJson(tx).
-		Do(ctx)
+	if _, err := dbTx.ExecContext(ctx, `UPDATE accounts SET closed_at = $1 WHERE id = $2`, time.Now(), id); err != nil {
+		log.Printf("Error closing account: %v", err)
+		return err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		log.Printf("Error committing account close transaction: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (t transactionRepository) CreateTransaction(ctx context.Context, tx *model.Transaction) error {
+	dbTx, err := t.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Error indexing transaction in Elasticsearch: %v", err)
+		log.Printf("Error starting transaction: %v", err)
 		return err
 	}
+	defer func(dbTx *sql.Tx) {
+		err := dbTx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}(dbTx)
 
+	if err := insertTransaction(ctx, dbTx, tx); err != nil {
+		return err
+	}
+	if err := dbTx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return err
+	}
 	return nil
 }
 
-func (t transactionRepository) FindHistoryByAccountID(ctx context.Context, accountID string, page, limit int) ([]*model.Transaction, int64, error) {
-	query := `SELECT id, from_account_id, to_account_id, amount, transaction_type, notes, created_at 
-			  FROM transactions 
-			  WHERE from_account_id = $1 OR to_account_id = $1 
-			  ORDER BY created_at DESC 
-			  LIMIT $2 OFFSET $3`
-	rows, err := t.db.QueryContext(ctx, query, accountID, limit, (page-1)*limit)
+// Topup credits the destination account and records the transaction with its
+// journal entry in a single database transaction, so a balance is never changed
+// without its history row and ledger postings. When key was already used for
+// the same request, the original transaction is returned and nothing is written.
+func (t transactionRepository) Topup(ctx context.Context, tx *model.Transaction, key *model.IdempotencyKey) (*model.Transaction, error) {
+	dbTx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting topup transaction: %v", err)
+		return nil, err
+	}
+	defer func(dbTx *sql.Tx) {
+		err := dbTx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Error rolling back topup transaction: %v", err)
+		}
+	}(dbTx)
+
+	if key != nil {
+		original, err := claimIdempotencyKey(ctx, dbTx, key)
+		if err != nil || original != nil {
+			return original, err
+		}
+	}
+
+	var currency string
+	var closedAt sql.NullTime
+	err = dbTx.QueryRowContext(ctx, `UPDATE accounts SET balance = balance + $1 WHERE id = $2 RETURNING currency, closed_at`, tx.Amount, tx.ToAccountID).Scan(&currency, &closedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		log.Printf("Error crediting account balance: %v", err)
+		return nil, err
+	}
+	if closedAt.Valid {
+		return nil, ErrAccountClosed
+	}
+	if currency != tx.Currency {
+		return nil, ErrCurrencyMismatch
+	}
+
+	if err := insertTransaction(ctx, dbTx, tx); err != nil {
+		return nil, err
+	}
+	if err := insertJournalEntry(ctx, dbTx, model.NewJournalEntry(tx)); err != nil {
+		return nil, err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		log.Printf("Error committing topup transaction: %v", err)
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Transfer moves funds between two accounts. Both rows are locked in ascending ID
+// order regardless of direction, so opposing transfers between the same pair of
+// wallets queue behind each other instead of deadlocking. Idempotency keys
+// behave as in Topup.
+func (t transactionRepository) Transfer(ctx context.Context, tx *model.Transaction, key *model.IdempotencyKey) (*model.Transaction, error) {
+	dbTx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error starting transfer transaction: %v", err)
+		return nil, err
+	}
+	defer func(dbTx *sql.Tx) {
+		err := dbTx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("Error rolling back transfer transaction: %v", err)
+		}
+	}(dbTx)
+
+	if key != nil {
+		original, err := claimIdempotencyKey(ctx, dbTx, key)
+		if err != nil || original != nil {
+			return original, err
+		}
+	}
+
+	ids := []string{tx.FromAccountID, tx.ToAccountID}
+	sort.Strings(ids)
+	balances := make(map[string]int64, len(ids))
+	for _, id := range ids {
+		var balance int64
+		var currency string
+		var closedAt sql.NullTime
+		err := dbTx.QueryRowContext(ctx, `SELECT balance, currency, closed_at FROM accounts WHERE id = $1 FOR UPDATE`, id).Scan(&balance, &currency, &closedAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrAccountNotFound
+			}
+			log.Printf("Error locking account: %v", err)
+			return nil, err
+		}
+		if closedAt.Valid {
+			return nil, ErrAccountClosed
+		}
+		if currency != tx.Currency {
+			return nil, ErrCurrencyMismatch
+		}
+		balances[id] = balance
+	}
+
+	if balances[tx.FromAccountID] < tx.Amount {
+		return nil, ErrInsufficientFunds
+	}
+
+	if _, err := dbTx.ExecContext(ctx, `UPDATE accounts SET balance = balance - $1 WHERE id = $2`, tx.Amount, tx.FromAccountID); err != nil {
+		log.Printf("Error debiting account balance: %v", err)
+		return nil, err
+	}
+	if _, err := dbTx.ExecContext(ctx, `UPDATE accounts SET balance = balance + $1 WHERE id = $2`, tx.Amount, tx.ToAccountID); err != nil {
+		log.Printf("Error crediting account balance: %v", err)
+		return nil, err
+	}
+
+	if err := insertTransaction(ctx, dbTx, tx); err != nil {
+		return nil, err
+	}
+	if err := insertJournalEntry(ctx, dbTx, model.NewJournalEntry(tx)); err != nil {
+		return nil, err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		log.Printf("Error committing transfer transaction: %v", err)
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func insertTransaction(ctx context.Context, dbTx *sql.Tx, tx *model.Transaction) error {
+	query := `INSERT INTO transactions (id, from_account_id, to_account_id, amount, currency, transaction_type, notes, created_at) 
+			  VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8)`
+	_, err := dbTx.ExecContext(ctx, query, tx.ID, tx.FromAccountID, tx.ToAccountID, tx.Amount, tx.Currency, tx.TransactionType, tx.Notes, tx.CreatedAt)
+	if err != nil {
+		log.Printf("Error inserting transaction: %v", err)
+		return err
+	}
+	return insertIndexOutbox(ctx, dbTx, tx.ID)
+}
+
+func (t transactionRepository) FindHistory(ctx context.Context, filter model.HistoryFilter, after *model.HistoryCursor, limit int) ([]*model.Transaction, error) {
+	args := []interface{}{filter.AccountID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var conditions []string
+	if filter.TransactionType != "" {
+		conditions = append(conditions, "transaction_type = "+arg(string(filter.TransactionType)))
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(filter.To))
+	}
+	if filter.MinAmount > 0 {
+		conditions = append(conditions, "amount >= "+arg(filter.MinAmount))
+	}
+	if filter.MaxAmount > 0 {
+		conditions = append(conditions, "amount <= "+arg(filter.MaxAmount))
+	}
+	if after != nil {
+		conditions = append(conditions, "(created_at, id) < ("+arg(after.CreatedAt)+", "+arg(after.ID)+")")
+	}
+	limitArg := arg(limit)
+
+	var where string
+	for _, c := range conditions {
+		where += " AND " + c
+	}
+	branch := func(column string) string {
+		return `SELECT id, COALESCE(from_account_id, '') AS from_account_id, to_account_id, amount, currency, transaction_type, notes, created_at
+				  FROM transactions
+				  WHERE ` + column + ` = $1` + where + `
+				  ORDER BY created_at DESC, id DESC
+				  LIMIT ` + limitArg
+	}
+
+	var query string
+	switch filter.Direction {
+	case model.Outgoing:
+		query = branch("from_account_id")
+	case model.Incoming:
+		query = branch("to_account_id")
+	default:
+		query = `SELECT * FROM ((` + branch("from_account_id") + `) UNION ALL (` + branch("to_account_id") + `)) history
+				  ORDER BY created_at DESC, id DESC
+				  LIMIT ` + limitArg
+	}
+
+	rows, err := t.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		log.Printf("Error querying transaction history: %v", err)
-		return nil, 0, err
+		return nil, err
 	}
 	defer func(rows *sql.Rows) {
 		err := rows.Close()
@@ -81,20 +395,69 @@ func (t transactionRepository) FindHistoryByAccountID(ctx context.Context, accou
 	var transactions []*model.Transaction
 	for rows.Next() {
 		tx := &model.Transaction{}
-		if err := rows.Scan(&tx.ID, &tx.FromAccountID, &tx.ToAccountID, &tx.Amount, &tx.TransactionType, &tx.Notes, &tx.CreatedAt); err != nil {
+		if err := rows.Scan(&tx.ID, &tx.FromAccountID, &tx.ToAccountID, &tx.Amount, &tx.Currency, &tx.TransactionType, &tx.Notes, &tx.CreatedAt); err != nil {
 			log.Printf("Error scanning transaction: %v", err)
-			return nil, 0, err
+			return nil, err
 		}
 		transactions = append(transactions, tx)
 	}
+	return transactions, rows.Err()
+}
+
+// documentQuery selects transactions as search documents, with the names of
+// both parties.
+const documentQuery = `SELECT t.id, COALESCE(t.from_account_id, ''), COALESCE(f.name, ''), t.to_account_id, COALESCE(r.name, ''),
+				  t.amount, t.currency, t.transaction_type, t.notes, t.created_at
+			  FROM transactions t
+			  LEFT JOIN accounts f ON f.id = t.from_account_id
+			  LEFT JOIN accounts r ON r.id = t.to_account_id`
+
+// FindDocuments returns up to limit transactions as search documents, oldest
+// first, that come after the after cursor, so the whole table can be streamed
+// in batches.
+func (t transactionRepository) FindDocuments(ctx context.Context, after *model.HistoryCursor, limit int) ([]*model.TransactionDocument, error) {
+	query := documentQuery
+	args := []interface{}{limit}
+	if after != nil {
+		query += ` WHERE (t.created_at, t.id) > ($2, $3)`
+		args = append(args, after.CreatedAt, after.ID)
+	}
+	query += ` ORDER BY t.created_at, t.id LIMIT $1`
 
-	countQuery := `SELECT COUNT(*) FROM transactions WHERE from_account_id = $1 OR to_account_id = $1`
-	var total int64
-	err = t.db.QueryRowContext(ctx, countQuery, accountID).Scan(&total)
+	rows, err := t.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Printf("Error counting transactions: %v", err)
-		return nil, 0, err
+		log.Printf("Error querying transaction documents: %v", err)
+		return nil, err
 	}
+	return scanDocuments(rows)
+}
 
-	return transactions, total, nil
+func findDocumentsByID(ctx context.Context, dbTx *sql.Tx, ids []string) ([]*model.TransactionDocument, error) {
+	rows, err := dbTx.QueryContext(ctx, documentQuery+` WHERE t.id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		log.Printf("Error querying transaction documents: %v", err)
+		return nil, err
+	}
+	return scanDocuments(rows)
+}
+
+func scanDocuments(rows *sql.Rows) ([]*model.TransactionDocument, error) {
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error closing rows: %v", err)
+		}
+	}(rows)
+
+	var docs []*model.TransactionDocument
+	for rows.Next() {
+		doc := &model.TransactionDocument{}
+		if err := rows.Scan(&doc.ID, &doc.FromAccountID, &doc.FromAccountName, &doc.ToAccountID, &doc.ToAccountName,
+			&doc.Amount, &doc.Currency, &doc.TransactionType, &doc.Notes, &doc.CreatedAt); err != nil {
+			log.Printf("Error scanning transaction document: %v", err)
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
 }
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+// walletDB answers the statements of Topup and Transfer for open IDR wallets
+// with the given balances.
+func walletDB(t *testing.T, balances map[string]int64) (*fakeDB, TransactionRepository) {
+	fake, db := newFakeDB(t, walletResponder(balances))
+	return fake, NewTransactionRepository(db)
+}
+
+func walletResponder(balances map[string]int64) func(query string, args []driver.Value) fakeResult {
+	return func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.Contains(query, "SELECT balance, currency, closed_at FROM accounts"):
+			balance, ok := balances[args[0].(string)]
+			if !ok {
+				return fakeResult{columns: []string{"balance", "currency", "closed_at"}}
+			}
+			return fakeResult{
+				columns: []string{"balance", "currency", "closed_at"},
+				rows:    [][]driver.Value{{balance, "IDR", nil}},
+			}
+		case strings.Contains(query, "RETURNING currency, closed_at"):
+			return fakeResult{columns: []string{"currency", "closed_at"}, rows: [][]driver.Value{{"IDR", nil}}}
+		case strings.Contains(query, "INSERT INTO journal_entries"):
+			return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{"entry-1"}}}
+		default:
+			return fakeResult{affected: 1}
+		}
+	}
+}
+
+func newTransfer(from, to string, amount int64) *model.Transaction {
+	return &model.Transaction{
+		ID:              "tx-1",
+		FromAccountID:   from,
+		ToAccountID:     to,
+		Amount:          amount,
+		Currency:        "IDR",
+		TransactionType: model.Transfer,
+		Notes:           "Transfer",
+		CreatedAt:       time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+// topupDB answers the statements of Topup for an account with currency, which
+// is closed when closed is set; there is no account when currency is empty.
+// Recording the transaction fails with insertErr.
+func topupDB(t *testing.T, currency string, closed bool, insertErr error) (*fakeDB, TransactionRepository) {
+	fake, db := newFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.Contains(query, "RETURNING currency, closed_at"):
+			result := fakeResult{columns: []string{"currency", "closed_at"}}
+			if currency != "" {
+				var closedAt driver.Value
+				if closed {
+					closedAt = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+				}
+				result.rows = [][]driver.Value{{currency, closedAt}}
+			}
+			return result
+		case strings.Contains(query, "INSERT INTO transactions"):
+			return fakeResult{affected: 1, err: insertErr}
+		case strings.Contains(query, "INSERT INTO journal_entries"):
+			return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{"entry-1"}}}
+		default:
+			return fakeResult{affected: 1}
+		}
+	})
+	return fake, NewTransactionRepository(db)
+}
+
+func TestTopup(t *testing.T) {
+	errInsert := errors.New("connection reset")
+
+	tests := []struct {
+		name      string
+		currency  string
+		closed    bool
+		insertErr error
+		wantErr   error
+	}{
+		{name: "credited", currency: "IDR"},
+		{name: "unknown account", wantErr: ErrAccountNotFound},
+		{name: "closed account", currency: "IDR", closed: true, wantErr: ErrAccountClosed},
+		{name: "other currency", currency: "USD", wantErr: ErrCurrencyMismatch},
+		{name: "history row fails", currency: "IDR", insertErr: errInsert, wantErr: errInsert},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, repo := topupDB(t, tt.currency, tt.closed, tt.insertErr)
+			tx := &model.Transaction{ID: "tx-1", ToAccountID: "acc-a", Amount: 5000, Currency: "IDR",
+				TransactionType: model.Topup, Notes: "Topup", CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+			recorded, err := repo.Topup(context.Background(), tx, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Topup() error = %v, want %v", err, tt.wantErr)
+			}
+
+			credits := fake.find("UPDATE accounts SET balance = balance + $1")
+			if len(credits) != 1 || credits[0].args[0] != int64(5000) || credits[0].args[1] != "acc-a" {
+				t.Errorf("credits = %+v, want one of 5000 to acc-a", credits)
+			}
+			// The credit is only kept together with the history row and the
+			// ledger postings.
+			if tt.wantErr != nil {
+				if fake.committed {
+					t.Error("failed topup was committed")
+				}
+				return
+			}
+			if recorded != tx {
+				t.Errorf("Topup() = %+v, want the recorded transaction", recorded)
+			}
+			if len(fake.find("INSERT INTO transactions")) != 1 || len(fake.find("INSERT INTO postings")) != 2 {
+				t.Errorf("topup wrote %+v, want its history row and two postings", fake.statements)
+			}
+			if !fake.committed {
+				t.Error("topup was not committed")
+			}
+		})
+	}
+}
+
+func TestTransferLocksAccountsInIDOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+	}{
+		{name: "lower to higher", from: "acc-a", to: "acc-b"},
+		{name: "higher to lower", from: "acc-b", to: "acc-a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, repo := walletDB(t, map[string]int64{"acc-a": 10000, "acc-b": 10000})
+
+			if _, err := repo.Transfer(context.Background(), newTransfer(tt.from, tt.to, 100), nil); err != nil {
+				t.Fatalf("Transfer() error = %v", err)
+			}
+
+			locks := fake.find("FOR UPDATE")
+			if len(locks) != 2 {
+				t.Fatalf("got %d row locks, want 2", len(locks))
+			}
+			if locks[0].args[0] != "acc-a" || locks[1].args[0] != "acc-b" {
+				t.Errorf("locked %v then %v, want acc-a then acc-b", locks[0].args[0], locks[1].args[0])
+			}
+		})
+	}
+}
+
+func TestTransferInsufficientFunds(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance int64
+		amount  int64
+		wantErr error
+	}{
+		{name: "more than the balance", balance: 999, amount: 1000, wantErr: ErrInsufficientFunds},
+		{name: "empty wallet", balance: 0, amount: 1, wantErr: ErrInsufficientFunds},
+		{name: "exactly the balance", balance: 1000, amount: 1000},
+		{name: "less than the balance", balance: 1001, amount: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, repo := walletDB(t, map[string]int64{"acc-a": tt.balance, "acc-b": 0})
+
+			_, err := repo.Transfer(context.Background(), newTransfer("acc-a", "acc-b", tt.amount), nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transfer() error = %v, want %v", err, tt.wantErr)
+			}
+
+			updates := fake.find("UPDATE accounts SET balance")
+			if tt.wantErr != nil {
+				if len(updates) != 0 || len(fake.find("INSERT INTO")) != 0 {
+					t.Errorf("failed transfer wrote to the database: %+v", fake.statements)
+				}
+				if fake.committed {
+					t.Error("failed transfer was committed")
+				}
+				return
+			}
+			if len(updates) != 2 {
+				t.Fatalf("got %d balance updates, want 2", len(updates))
+			}
+			if updates[0].args[0] != tt.amount || updates[0].args[1] != "acc-a" {
+				t.Errorf("first update args = %v, want debit of %d from acc-a", updates[0].args, tt.amount)
+			}
+			if !fake.committed {
+				t.Error("transfer was not committed")
+			}
+		})
+	}
+}
+
+func TestPostingsBalanced(t *testing.T) {
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name       string
+		tx         *model.Transaction
+		post       func(repo TransactionRepository, tx *model.Transaction) error
+		wantDebit  string
+		wantCredit string
+	}{
+		{
+			name: "topup",
+			tx: &model.Transaction{ID: "tx-1", ToAccountID: "acc-a", Amount: 5000, Currency: "IDR",
+				TransactionType: model.Topup, CreatedAt: createdAt},
+			post: func(repo TransactionRepository, tx *model.Transaction) error {
+				_, err := repo.Topup(context.Background(), tx, nil)
+				return err
+			},
+			wantDebit:  model.TopupFundingAccountID,
+			wantCredit: "acc-a",
+		},
+		{
+			name: "transfer",
+			tx:   newTransfer("acc-a", "acc-b", 2500),
+			post: func(repo TransactionRepository, tx *model.Transaction) error {
+				_, err := repo.Transfer(context.Background(), tx, nil)
+				return err
+			},
+			wantDebit:  "acc-a",
+			wantCredit: "acc-b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, repo := walletDB(t, map[string]int64{"acc-a": 10000, "acc-b": 0})
+
+			if err := tt.post(repo, tt.tx); err != nil {
+				t.Fatalf("posting %s: %v", tt.name, err)
+			}
+
+			postings := fake.find("INSERT INTO postings")
+			if len(postings) == 0 {
+				t.Fatal("no postings were written")
+			}
+			net := make(map[string]int64)
+			accounts := make(map[string]string)
+			for _, p := range postings {
+				// journal_entry_id, account_id, direction, amount, currency, created_at
+				if p.args[0] != "entry-1" {
+					t.Errorf("posting belongs to entry %v, want entry-1", p.args[0])
+				}
+				amount, currency := p.args[3].(int64), p.args[4].(string)
+				switch p.args[2] {
+				case string(model.Debit):
+					net[currency] -= amount
+				case string(model.Credit):
+					net[currency] += amount
+				default:
+					t.Fatalf("posting has direction %v", p.args[2])
+				}
+				accounts[p.args[2].(string)] = p.args[1].(string)
+			}
+			for currency, total := range net {
+				if total != 0 {
+					t.Errorf("postings in %s are off by %d", currency, total)
+				}
+			}
+			if accounts[string(model.Debit)] != tt.wantDebit || accounts[string(model.Credit)] != tt.wantCredit {
+				t.Errorf("debited %q and credited %q, want %q and %q",
+					accounts[string(model.Debit)], accounts[string(model.Credit)], tt.wantDebit, tt.wantCredit)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/repository"
+)
+
+type LedgerUseCase interface {
+	Audit(ctx context.Context) (*model.LedgerAudit, error)
+	RebuildBalances(ctx context.Context) (int64, error)
+}
+
+type ledgerUseCase struct {
+	repo repository.LedgerRepository
+}
+
+func NewLedgerUseCase(repo repository.LedgerRepository) LedgerUseCase {
+	return &ledgerUseCase{repo: repo}
+}
+
+// Audit checks that every journal entry balances and that every wallet balance
+// equals the sum of its postings.
+func (l *ledgerUseCase) Audit(ctx context.Context) (*model.LedgerAudit, error) {
+	unbalanced, err := l.repo.FindUnbalancedEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unbalanced journal entries: %w", err)
+	}
+
+	mismatches, err := l.repo.FindBalanceMismatches(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find balance mismatches: %w", err)
+	}
+
+	return &model.LedgerAudit{UnbalancedEntries: unbalanced, Mismatches: mismatches}, nil
+}
+
+// RebuildBalances recomputes wallet balances from the ledger. It refuses to run
+// while any journal entry is unbalanced, since the postings could not be trusted.
+func (l *ledgerUseCase) RebuildBalances(ctx context.Context) (int64, error) {
+	unbalanced, err := l.repo.FindUnbalancedEntries(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find unbalanced journal entries: %w", err)
+	}
+	if len(unbalanced) > 0 {
+		return 0, fmt.Errorf("%w: %d entries", repository.ErrUnbalancedEntry, len(unbalanced))
+	}
+
+	updated, err := l.repo.RebuildBalances(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild balances: %w", err)
+	}
+	return updated, nil
+}
@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+// Page tokens are opaque to clients: base64url encoded JSON holding where the
+// next page starts and a hash of the query it belongs to. A token is rejected
+// for any other account, filter, search text or sort, so a client cannot page
+// through one query with the position of another.
+
+type historyPageToken struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+	Query     string    `json:"query"`
+}
+
+type searchPageToken struct {
+	After []interface{} `json:"after"`
+	Query string        `json:"query"`
+}
+
+// queryHash identifies the account, filter and any further query terms, such
+// as search text and sort, that a page token was issued for.
+func queryHash(filter model.HistoryFilter, terms ...string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %s %s %d %d", filter.AccountID, filter.TransactionType, filter.Direction,
+		filter.From.UTC().Format(time.RFC3339Nano), filter.To.UTC().Format(time.RFC3339Nano), filter.MinAmount, filter.MaxAmount)
+	for _, term := range terms {
+		fmt.Fprintf(h, " %q", term)
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
+
+func encodePageToken(filter model.HistoryFilter, cursor *model.HistoryCursor) (string, error) {
+	data, err := json.Marshal(historyPageToken{CreatedAt: cursor.CreatedAt, ID: cursor.ID, Query: queryHash(filter)})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodePageToken(filter model.HistoryFilter, token string) (*model.HistoryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	var t historyPageToken
+	if err := json.Unmarshal(data, &t); err != nil || t.ID == "" || t.CreatedAt.IsZero() {
+		return nil, ErrInvalidPageToken
+	}
+	if t.Query != queryHash(filter) {
+		return nil, ErrInvalidPageToken.Withf("token belongs to another query")
+	}
+	return &model.HistoryCursor{CreatedAt: t.CreatedAt, ID: t.ID}, nil
+}
+
+// Search page tokens hold the Elasticsearch sort values of the last hit.
+
+func searchQueryHash(q *model.SearchQuery) string {
+	return queryHash(q.Filter, q.Text, string(q.Sort))
+}
+
+func encodeSearchAfter(q *model.SearchQuery, sortValues []interface{}) (string, error) {
+	data, err := json.Marshal(searchPageToken{After: sortValues, Query: searchQueryHash(q)})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeSearchAfter(q *model.SearchQuery, token string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var t searchPageToken
+	if err := decoder.Decode(&t); err != nil || len(t.After) == 0 {
+		return nil, ErrInvalidPageToken
+	}
+	if t.Query != searchQueryHash(q) {
+		return nil, ErrInvalidPageToken.Withf("token belongs to another query")
+	}
+	return t.After, nil
+}
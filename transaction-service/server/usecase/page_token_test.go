@@ -0,0 +1,186 @@
+package usecase
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+)
+
+var testFilter = model.HistoryFilter{
+	AccountID: "0194f1c2-7c5a-7b1e-9d3e-2f6a8b9c0d1e",
+	Direction: model.Outgoing,
+	From:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	MinAmount: 100000,
+}
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor *model.HistoryCursor
+	}{
+		{name: "utc", cursor: &model.HistoryCursor{CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 123456789, time.UTC), ID: "0194f1c2-7c5a-7b1e-9d3e-2f6a8b9c0d1e"}},
+		{name: "offset", cursor: &model.HistoryCursor{CreatedAt: time.Date(2025, 6, 30, 23, 59, 59, 0, time.FixedZone("WIB", 7*60*60)), ID: "tx-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := encodePageToken(testFilter, tt.cursor)
+			if err != nil {
+				t.Fatalf("encodePageToken() error = %v", err)
+			}
+			got, err := decodePageToken(testFilter, token)
+			if err != nil {
+				t.Fatalf("decodePageToken(%q) error = %v", token, err)
+			}
+			if got.ID != tt.cursor.ID || !got.CreatedAt.Equal(tt.cursor.CreatedAt) {
+				t.Errorf("round trip of %+v = %+v", tt.cursor, got)
+			}
+		})
+	}
+}
+
+func TestPageTokenSurvivesTimeZoneOfFilter(t *testing.T) {
+	token, err := encodePageToken(testFilter, &model.HistoryCursor{CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), ID: "tx-1"})
+	if err != nil {
+		t.Fatalf("encodePageToken() error = %v", err)
+	}
+	filter := testFilter
+	filter.From = filter.From.In(time.FixedZone("WIB", 7*60*60))
+	if _, err := decodePageToken(filter, token); err != nil {
+		t.Errorf("decodePageToken() with the same instant in another zone error = %v", err)
+	}
+}
+
+func TestDecodePageTokenRejectsTampering(t *testing.T) {
+	valid, err := encodePageToken(testFilter, &model.HistoryCursor{CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), ID: "tx-1"})
+	if err != nil {
+		t.Fatalf("encodePageToken() error = %v", err)
+	}
+	// Hand-built tokens carry the hash of testFilter, so each fails only for
+	// the reason its case is named after.
+	query := queryHash(testFilter)
+	encode := func(fields string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(fields))
+	}
+	withFilter := func(change func(*model.HistoryFilter)) model.HistoryFilter {
+		filter := testFilter
+		change(&filter)
+		return filter
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		filter model.HistoryFilter
+	}{
+		{name: "not base64", token: "not a token!"},
+		{name: "padded base64", token: valid + "=="},
+		{name: "standard alphabet", token: base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`{"created_at":"2025-01-02T03:04:05Z","id":"tx/+?","query":%q}`, query)))},
+		{name: "truncated", token: valid[:len(valid)-4]},
+		{name: "extra bytes", token: valid + "AAAA"},
+		{name: "not json", token: encode("created_at=2025-01-02&id=tx-1")},
+		{name: "not an object", token: encode(`["2025-01-02T03:04:05Z","tx-1"]`)},
+		{name: "missing id", token: encode(fmt.Sprintf(`{"created_at":"2025-01-02T03:04:05Z","query":%q}`, query))},
+		{name: "empty id", token: encode(fmt.Sprintf(`{"created_at":"2025-01-02T03:04:05Z","id":"","query":%q}`, query))},
+		{name: "missing created_at", token: encode(fmt.Sprintf(`{"id":"tx-1","query":%q}`, query))},
+		{name: "zero created_at", token: encode(fmt.Sprintf(`{"created_at":"0001-01-01T00:00:00Z","id":"tx-1","query":%q}`, query))},
+		{name: "malformed created_at", token: encode(fmt.Sprintf(`{"created_at":"yesterday","id":"tx-1","query":%q}`, query))},
+		{name: "wrong id type", token: encode(fmt.Sprintf(`{"created_at":"2025-01-02T03:04:05Z","id":42,"query":%q}`, query))},
+		{name: "missing query", token: encode(`{"created_at":"2025-01-02T03:04:05Z","id":"tx-1"}`)},
+		{name: "forged query", token: encode(`{"created_at":"2025-01-02T03:04:05Z","id":"tx-1","query":"AAAAAAAAAAAAAAAAAAAAAA"}`)},
+		{name: "other account", token: valid, filter: withFilter(func(f *model.HistoryFilter) { f.AccountID = "0194f1c2-7c5a-7b1e-9d3e-000000000000" })},
+		{name: "other direction", token: valid, filter: withFilter(func(f *model.HistoryFilter) { f.Direction = model.Incoming })},
+		{name: "other type", token: valid, filter: withFilter(func(f *model.HistoryFilter) { f.TransactionType = model.Topup })},
+		{name: "other from", token: valid, filter: withFilter(func(f *model.HistoryFilter) { f.From = f.From.Add(time.Second) })},
+		{name: "other to", token: valid, filter: withFilter(func(f *model.HistoryFilter) { f.To = f.From.AddDate(0, 1, 0) })},
+		{name: "other min amount", token: valid, filter: withFilter(func(f *model.HistoryFilter) { f.MinAmount = 1 })},
+		{name: "other max amount", token: valid, filter: withFilter(func(f *model.HistoryFilter) { f.MaxAmount = 500000 })},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			if filter.AccountID == "" {
+				filter = testFilter
+			}
+			if cursor, err := decodePageToken(filter, tt.token); !errors.Is(err, ErrInvalidPageToken) {
+				t.Errorf("decodePageToken(%q) = %+v, %v, want ErrInvalidPageToken", tt.token, cursor, err)
+			}
+		})
+	}
+}
+
+func TestSearchAfterRoundTrip(t *testing.T) {
+	q := &model.SearchQuery{Filter: testFilter, Text: "rent", Sort: model.SortNewest, Limit: 20}
+	values := []interface{}{float64(1735787045000), "tx-1"}
+	token, err := encodeSearchAfter(q, values)
+	if err != nil {
+		t.Fatalf("encodeSearchAfter() error = %v", err)
+	}
+	// The page size may change from one page to the next.
+	next := *q
+	next.Limit = 50
+	got, err := decodeSearchAfter(&next, token)
+	if err != nil {
+		t.Fatalf("decodeSearchAfter(%q) error = %v", token, err)
+	}
+	// Numbers come back as json.Number, so large sort values keep their precision.
+	want := []interface{}{json.Number("1735787045000"), "tx-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip of %v = %v", values, got)
+	}
+}
+
+func TestDecodeSearchAfterRejectsTampering(t *testing.T) {
+	q := &model.SearchQuery{Filter: testFilter, Text: "rent", Sort: model.SortNewest}
+	valid, err := encodeSearchAfter(q, []interface{}{float64(1735787045000), "tx-1"})
+	if err != nil {
+		t.Fatalf("encodeSearchAfter() error = %v", err)
+	}
+	query := searchQueryHash(q)
+	encode := func(fields string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(fields))
+	}
+	withQuery := func(change func(*model.SearchQuery)) *model.SearchQuery {
+		other := *q
+		change(&other)
+		return &other
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		query *model.SearchQuery
+	}{
+		{name: "not base64", token: "not a token!"},
+		{name: "not json", token: encode("1735787045000,tx-1")},
+		{name: "not an object", token: encode(`[1735787045000,"tx-1"]`)},
+		{name: "missing sort values", token: encode(fmt.Sprintf(`{"query":%q}`, query))},
+		{name: "empty sort values", token: encode(fmt.Sprintf(`{"after":[],"query":%q}`, query))},
+		{name: "null", token: encode(`null`)},
+		{name: "truncated", token: encode(`{"after":[1735787045000,"tx-`)},
+		{name: "missing query", token: encode(`{"after":[1735787045000,"tx-1"]}`)},
+		{name: "other account", token: valid, query: withQuery(func(o *model.SearchQuery) { o.Filter.AccountID = "0194f1c2-7c5a-7b1e-9d3e-000000000000" })},
+		{name: "other filter", token: valid, query: withQuery(func(o *model.SearchQuery) { o.Filter.MinAmount = 1 })},
+		{name: "other text", token: valid, query: withQuery(func(o *model.SearchQuery) { o.Text = "rental" })},
+		{name: "other sort", token: valid, query: withQuery(func(o *model.SearchQuery) { o.Sort = model.SortAmountDesc })},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			if query == nil {
+				query = q
+			}
+			if values, err := decodeSearchAfter(query, tt.token); !errors.Is(err, ErrInvalidPageToken) {
+				t.Errorf("decodeSearchAfter(%q) = %v, %v, want ErrInvalidPageToken", tt.token, values, err)
+			}
+		})
+	}
+}
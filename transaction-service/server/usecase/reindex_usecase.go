@@ -0,0 +1,154 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/repository"
+)
+
+const (
+	defaultReindexBatchSize = 1000
+	maxReindexBatchSize     = 10000
+	// catchUpWindow is how far before the start of a reindex its catch-up pass
+	// looks, covering transactions that committed late with an earlier created_at.
+	catchUpWindow = time.Minute
+)
+
+type ReindexUseCase interface {
+	Reindex(ctx context.Context, batchSize int, progress func(indexed int64)) (*model.ReindexResult, error)
+	Verify(ctx context.Context, batchSize int) (*model.IndexVerification, error)
+}
+
+type reindexUseCase struct {
+	transactionRepo repository.TransactionRepository
+	indexRepo       repository.IndexRepository
+}
+
+func NewReindexUseCase(transactionRepo repository.TransactionRepository, indexRepo repository.IndexRepository) ReindexUseCase {
+	return &reindexUseCase{
+		transactionRepo: transactionRepo,
+		indexRepo:       indexRepo,
+	}
+}
+
+// Reindex copies every transaction from Postgres into a new versioned index
+// and then points the transactions alias at it. Transactions written to the
+// old index while the copy ran are indexed again after the swap.
+func (r *reindexUseCase) Reindex(ctx context.Context, batchSize int, progress func(indexed int64)) (*model.ReindexResult, error) {
+	batchSize = reindexBatchSize(batchSize)
+	startedAt := time.Now()
+
+	index, err := r.indexRepo.CreateVersionedIndex(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index: %w", err)
+	}
+
+	result := &model.ReindexResult{Index: index}
+	indexed, err := r.copyDocuments(ctx, index, nil, batchSize, progress)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.indexRepo.FinishBulkIndexing(ctx, index); err != nil {
+		return nil, fmt.Errorf("failed to refresh index %s: %w", index, err)
+	}
+
+	result.PreviousIndexes, err = r.indexRepo.SwapAlias(ctx, index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to swap alias to %s: %w", index, err)
+	}
+
+	caughtUp, err := r.copyDocuments(ctx, index, &model.HistoryCursor{CreatedAt: startedAt.Add(-catchUpWindow)}, batchSize, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to catch up index %s: %w", index, err)
+	}
+	result.Indexed = indexed + caughtUp
+	return result, nil
+}
+
+func (r *reindexUseCase) copyDocuments(ctx context.Context, index string, after *model.HistoryCursor, batchSize int, progress func(indexed int64)) (int64, error) {
+	var indexed int64
+	for {
+		docs, err := r.transactionRepo.FindDocuments(ctx, after, batchSize)
+		if err != nil {
+			return indexed, fmt.Errorf("failed to read transactions: %w", err)
+		}
+		if len(docs) == 0 {
+			return indexed, nil
+		}
+		failures, err := r.indexRepo.BulkIndex(ctx, index, docs)
+		if err != nil {
+			return indexed, fmt.Errorf("failed to index transactions into %s: %w", index, err)
+		}
+		if len(failures) > 0 {
+			return indexed, fmt.Errorf("failed to index %d of %d transactions into %s", len(failures), len(docs), index)
+		}
+
+		indexed += int64(len(docs))
+		if progress != nil {
+			progress(indexed)
+		}
+		last := docs[len(docs)-1]
+		after = &model.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// Verify compares every transaction in Postgres with its document behind the
+// transactions alias.
+func (r *reindexUseCase) Verify(ctx context.Context, batchSize int) (*model.IndexVerification, error) {
+	batchSize = reindexBatchSize(batchSize)
+	verification := &model.IndexVerification{}
+
+	var after *model.HistoryCursor
+	for {
+		docs, err := r.transactionRepo.FindDocuments(ctx, after, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read transactions: %w", err)
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		ids := make([]string, 0, len(docs))
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+		indexed, err := r.indexRepo.GetDocuments(ctx, ids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read indexed transactions: %w", err)
+		}
+
+		for _, doc := range docs {
+			indexedDoc, ok := indexed[doc.ID]
+			switch {
+			case !ok:
+				verification.Missing = append(verification.Missing, doc.ID)
+			case !doc.Equal(indexedDoc):
+				verification.Mismatched = append(verification.Mismatched, doc.ID)
+			}
+		}
+
+		verification.Checked += int64(len(docs))
+		last := docs[len(docs)-1]
+		after = &model.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	count, err := r.indexRepo.CountDocuments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count indexed transactions: %w", err)
+	}
+	verification.IndexedCount = count
+	return verification, nil
+}
+
+func reindexBatchSize(batchSize int) int {
+	if batchSize < 1 {
+		return defaultReindexBatchSize
+	}
+	if batchSize > maxReindexBatchSize {
+		return maxReindexBatchSize
+	}
+	return batchSize
+}
@@ -0,0 +1,197 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/repository"
+)
+
+// fakeDocumentRepository serves docs in (created_at, id) order, as
+// FindDocuments does. Methods the tests do not use panic through the embedded
+// nil interface.
+type fakeDocumentRepository struct {
+	repository.TransactionRepository
+	docs []*model.TransactionDocument
+}
+
+func (f *fakeDocumentRepository) add(docs ...*model.TransactionDocument) {
+	f.docs = append(f.docs, docs...)
+	sort.Slice(f.docs, func(i, j int) bool {
+		if !f.docs[i].CreatedAt.Equal(f.docs[j].CreatedAt) {
+			return f.docs[i].CreatedAt.Before(f.docs[j].CreatedAt)
+		}
+		return f.docs[i].ID < f.docs[j].ID
+	})
+}
+
+func (f *fakeDocumentRepository) FindDocuments(_ context.Context, after *model.HistoryCursor, limit int) ([]*model.TransactionDocument, error) {
+	var page []*model.TransactionDocument
+	for _, doc := range f.docs {
+		if after != nil && (doc.CreatedAt.Before(after.CreatedAt) || doc.CreatedAt.Equal(after.CreatedAt) && doc.ID <= after.ID) {
+			continue
+		}
+		page = append(page, doc)
+		if len(page) == limit {
+			break
+		}
+	}
+	return page, nil
+}
+
+// fakeIndexRepository records which documents went into which index, and
+// whether the alias had been swapped by then. onSwap, when set, runs when the
+// alias is swapped.
+type fakeIndexRepository struct {
+	repository.IndexRepository
+	onSwap  func()
+	fail    map[string]bool
+	swapped bool
+	// indexed lists the IDs indexed into each index before and after the swap.
+	beforeSwap map[string][]string
+	afterSwap  map[string][]string
+}
+
+func newFakeIndexRepository() *fakeIndexRepository {
+	return &fakeIndexRepository{beforeSwap: map[string][]string{}, afterSwap: map[string][]string{}}
+}
+
+func (f *fakeIndexRepository) CreateVersionedIndex(context.Context) (string, error) {
+	return "transactions_v2", nil
+}
+
+func (f *fakeIndexRepository) BulkIndex(_ context.Context, index string, docs []*model.TransactionDocument) (map[string]error, error) {
+	failures := make(map[string]error)
+	for _, doc := range docs {
+		if f.fail[doc.ID] {
+			failures[doc.ID] = errors.New("mapper_parsing_exception")
+			continue
+		}
+		if f.swapped {
+			f.afterSwap[index] = append(f.afterSwap[index], doc.ID)
+		} else {
+			f.beforeSwap[index] = append(f.beforeSwap[index], doc.ID)
+		}
+	}
+	return failures, nil
+}
+
+func (f *fakeIndexRepository) FinishBulkIndexing(context.Context, string) error {
+	return nil
+}
+
+func (f *fakeIndexRepository) SwapAlias(context.Context, string) ([]string, error) {
+	f.swapped = true
+	if f.onSwap != nil {
+		f.onSwap()
+	}
+	return []string{"transactions_v1"}, nil
+}
+
+func document(id string, createdAt time.Time) *model.TransactionDocument {
+	return &model.TransactionDocument{ID: id, ToAccountID: "acc-a", Amount: 1000, Currency: "IDR",
+		TransactionType: model.Topup, Notes: "Topup", CreatedAt: createdAt}
+}
+
+func TestReindexCatchesUpAfterSwap(t *testing.T) {
+	old := time.Now().Add(-24 * time.Hour)
+	transactions := &fakeDocumentRepository{}
+	for i := 1; i <= 5; i++ {
+		transactions.add(document(fmt.Sprintf("tx-%d", i), old.Add(time.Duration(i)*time.Minute)))
+	}
+	index := newFakeIndexRepository()
+	// While the copy ran, the indexer kept writing new transactions to the
+	// index the alias pointed at. One committed late with an earlier
+	// created_at, but still within the catch-up window.
+	index.onSwap = func() {
+		transactions.add(document("tx-new", time.Now()), document("tx-late", time.Now().Add(-catchUpWindow/2)))
+	}
+	uc := NewReindexUseCase(transactions, index)
+
+	var progress []int64
+	result, err := uc.Reindex(context.Background(), 2, func(indexed int64) { progress = append(progress, indexed) })
+	if err != nil {
+		t.Fatalf("Reindex() error = %v", err)
+	}
+
+	if want := []string{"tx-1", "tx-2", "tx-3", "tx-4", "tx-5"}; !reflect.DeepEqual(index.beforeSwap["transactions_v2"], want) {
+		t.Errorf("copied %v before the swap, want %v", index.beforeSwap["transactions_v2"], want)
+	}
+	if want := []string{"tx-late", "tx-new"}; !reflect.DeepEqual(index.afterSwap["transactions_v2"], want) {
+		t.Errorf("caught up %v after the swap, want %v", index.afterSwap["transactions_v2"], want)
+	}
+	if result.Index != "transactions_v2" || result.Indexed != 7 || !reflect.DeepEqual(result.PreviousIndexes, []string{"transactions_v1"}) {
+		t.Errorf("Reindex() = %+v", result)
+	}
+	if want := []int64{2, 4, 5}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("progress %v, want %v", progress, want)
+	}
+}
+
+func TestReindexKeepsAliasOnFailure(t *testing.T) {
+	transactions := &fakeDocumentRepository{}
+	transactions.add(document("tx-1", time.Now().Add(-time.Hour)), document("tx-2", time.Now().Add(-time.Hour)))
+	index := newFakeIndexRepository()
+	index.fail = map[string]bool{"tx-2": true}
+	uc := NewReindexUseCase(transactions, index)
+
+	if _, err := uc.Reindex(context.Background(), 10, nil); err == nil {
+		t.Fatal("Reindex() succeeded with a document that failed to index")
+	}
+	if index.swapped {
+		t.Error("alias was swapped to an incomplete index")
+	}
+}
+
+// indexedDocuments serves GetDocuments and CountDocuments from docs.
+type indexedDocuments struct {
+	*fakeIndexRepository
+	docs map[string]*model.TransactionDocument
+}
+
+func (f *indexedDocuments) GetDocuments(_ context.Context, ids []string) (map[string]*model.TransactionDocument, error) {
+	found := make(map[string]*model.TransactionDocument)
+	for _, id := range ids {
+		if doc, ok := f.docs[id]; ok {
+			found[id] = doc
+		}
+	}
+	return found, nil
+}
+
+func (f *indexedDocuments) CountDocuments(context.Context) (int64, error) {
+	return int64(len(f.docs)), nil
+}
+
+func TestVerify(t *testing.T) {
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	transactions := &fakeDocumentRepository{}
+	for i := 1; i <= 4; i++ {
+		transactions.add(document(fmt.Sprintf("tx-%d", i), createdAt.Add(time.Duration(i)*time.Second)))
+	}
+
+	changed := *transactions.docs[1]
+	changed.Notes = "Rent"
+	index := &indexedDocuments{fakeIndexRepository: newFakeIndexRepository(), docs: map[string]*model.TransactionDocument{
+		"tx-1":     transactions.docs[0],
+		"tx-2":     &changed,
+		"tx-4":     transactions.docs[3],
+		"tx-stray": document("tx-stray", createdAt),
+	}}
+	uc := NewReindexUseCase(transactions, index)
+
+	verification, err := uc.Verify(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	want := &model.IndexVerification{Checked: 4, IndexedCount: 4, Missing: []string{"tx-3"}, Mismatched: []string{"tx-2"}}
+	if !reflect.DeepEqual(verification, want) {
+		t.Errorf("Verify() = %+v, want %+v", verification, want)
+	}
+}
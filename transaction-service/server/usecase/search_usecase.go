@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/apperr"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/money"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/repository"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxSearchTextLen   = 256
+)
+
+const (
+	defaultSummaryPeriod     = 30 * 24 * time.Hour
+	defaultTopCounterparties = 5
+	maxTopCounterparties     = 20
+	// maxSummaryBuckets bounds the date histogram, e.g. a little over a year of days.
+	maxSummaryBuckets = 400
+)
+
+var (
+	ErrInvalidSearch  = apperr.New(apperr.ErrInvalidArgument, "INVALID_SEARCH", "invalid search")
+	ErrInvalidSummary = apperr.New(apperr.ErrInvalidArgument, "INVALID_SUMMARY", "invalid spending summary")
+)
+
+// approximate bucket widths, used only to bound the number of buckets.
+var summaryIntervals = map[model.SummaryInterval]time.Duration{
+	model.IntervalDay:   24 * time.Hour,
+	model.IntervalWeek:  7 * 24 * time.Hour,
+	model.IntervalMonth: 28 * 24 * time.Hour,
+}
+
+type SearchUseCase interface {
+	SearchTransactions(ctx context.Context, q *model.SearchQuery, pageToken string) (*model.SearchResult, error)
+	GetSpendingSummary(ctx context.Context, q *model.SpendingSummaryQuery) (*model.SpendingSummary, error)
+}
+
+type searchUseCase struct {
+	repo repository.SearchRepository
+}
+
+func NewSearchUseCase(repo repository.SearchRepository) SearchUseCase {
+	return &searchUseCase{repo: repo}
+}
+
+// SearchTransactions runs a free-text search over the transactions of
+// q.Filter.AccountID. Callers must make sure that account belongs to the caller.
+func (s *searchUseCase) SearchTransactions(ctx context.Context, q *model.SearchQuery, pageToken string) (*model.SearchResult, error) {
+	if q.Filter.AccountID == "" {
+		return nil, ErrInvalidAccount
+	}
+	if err := validateHistoryFilter(q.Filter); err != nil {
+		return nil, err
+	}
+	if len(q.Text) > maxSearchTextLen {
+		return nil, ErrInvalidSearch.Withf("query must not exceed %d characters", maxSearchTextLen)
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = model.SortRelevance
+	case model.SortRelevance, model.SortNewest, model.SortOldest, model.SortAmountDesc, model.SortAmountAsc:
+	default:
+		return nil, ErrInvalidSearch.Withf("unknown sort %q", q.Sort)
+	}
+	if q.Limit < 1 {
+		q.Limit = defaultSearchLimit
+	}
+	if q.Limit > maxSearchLimit {
+		q.Limit = maxSearchLimit
+	}
+
+	if pageToken != "" {
+		searchAfter, err := decodeSearchAfter(q, pageToken)
+		if err != nil {
+			return nil, err
+		}
+		q.SearchAfter = searchAfter
+	}
+
+	hits, total, err := s.repo.SearchTransactions(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search transactions: %w", err)
+	}
+
+	result := &model.SearchResult{Hits: hits, Total: total}
+	if len(hits) == q.Limit && int64(len(hits)) < total {
+		result.NextPageToken, err = encodeSearchAfter(q, hits[len(hits)-1].SortValues)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// GetSpendingSummary aggregates the transactions of q.AccountID over
+// [q.From, q.To), the last 30 days by default, in monthly buckets unless
+// another interval is requested. Callers must make sure that account belongs
+// to the caller.
+func (s *searchUseCase) GetSpendingSummary(ctx context.Context, q *model.SpendingSummaryQuery) (*model.SpendingSummary, error) {
+	if q.AccountID == "" {
+		return nil, ErrInvalidAccount
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-defaultSummaryPeriod)
+	}
+	if !q.From.Before(q.To) {
+		return nil, ErrInvalidSummary.Withf("from_time must be before to_time")
+	}
+	if q.Interval == "" {
+		q.Interval = model.IntervalMonth
+	}
+	width, ok := summaryIntervals[q.Interval]
+	if !ok {
+		return nil, ErrInvalidSummary.Withf("unknown interval %q", q.Interval)
+	}
+	if q.To.Sub(q.From)/width > maxSummaryBuckets {
+		return nil, ErrInvalidSummary.Withf("range is too long for %s buckets", q.Interval)
+	}
+	if q.TimeZone == "" {
+		q.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(q.TimeZone); err != nil {
+		return nil, ErrInvalidSummary.Withf("unknown time zone %q", q.TimeZone)
+	}
+	if q.TopCounterparties < 1 {
+		q.TopCounterparties = defaultTopCounterparties
+	}
+	if q.TopCounterparties > maxTopCounterparties {
+		q.TopCounterparties = maxTopCounterparties
+	}
+
+	summary, err := s.repo.SpendingSummary(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize spending: %w", err)
+	}
+	if summary.Currency == "" {
+		summary.Currency = money.DefaultCurrency
+	}
+	return summary, nil
+}
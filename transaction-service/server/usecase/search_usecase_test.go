@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/repository"
+)
+
+// fakeSearchRepository records the summary queries it is asked for and
+// answers them with an empty summary. Methods the tests do not use panic
+// through the embedded nil interface.
+type fakeSearchRepository struct {
+	repository.SearchRepository
+	summaries []model.SpendingSummaryQuery
+}
+
+func (f *fakeSearchRepository) SpendingSummary(_ context.Context, q *model.SpendingSummaryQuery) (*model.SpendingSummary, error) {
+	f.summaries = append(f.summaries, *q)
+	return &model.SpendingSummary{}, nil
+}
+
+func TestGetSpendingSummary(t *testing.T) {
+	to := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		q       model.SpendingSummaryQuery
+		want    model.SpendingSummaryQuery
+		wantErr error
+	}{
+		{
+			name: "defaults",
+			q:    model.SpendingSummaryQuery{AccountID: "acc-a", To: to},
+			want: model.SpendingSummaryQuery{AccountID: "acc-a", From: to.Add(-defaultSummaryPeriod), To: to,
+				Interval: model.IntervalMonth, TimeZone: "UTC", TopCounterparties: defaultTopCounterparties},
+		},
+		{
+			name: "counterparties capped",
+			q: model.SpendingSummaryQuery{AccountID: "acc-a", From: to.AddDate(0, -1, 0), To: to,
+				Interval: model.IntervalWeek, TimeZone: "Asia/Jakarta", TopCounterparties: 1000},
+			want: model.SpendingSummaryQuery{AccountID: "acc-a", From: to.AddDate(0, -1, 0), To: to,
+				Interval: model.IntervalWeek, TimeZone: "Asia/Jakarta", TopCounterparties: maxTopCounterparties},
+		},
+		{
+			name:    "no account",
+			q:       model.SpendingSummaryQuery{To: to},
+			wantErr: ErrInvalidAccount,
+		},
+		{
+			name:    "from after to",
+			q:       model.SpendingSummaryQuery{AccountID: "acc-a", From: to, To: to.Add(-time.Hour)},
+			wantErr: ErrInvalidSummary,
+		},
+		{
+			name:    "unknown interval",
+			q:       model.SpendingSummaryQuery{AccountID: "acc-a", To: to, Interval: "year"},
+			wantErr: ErrInvalidSummary,
+		},
+		{
+			name:    "too many buckets",
+			q:       model.SpendingSummaryQuery{AccountID: "acc-a", From: to.AddDate(-2, 0, 0), To: to, Interval: model.IntervalDay},
+			wantErr: ErrInvalidSummary,
+		},
+		{
+			name:    "unknown time zone",
+			q:       model.SpendingSummaryQuery{AccountID: "acc-a", To: to, TimeZone: "Mars/Olympus"},
+			wantErr: ErrInvalidSummary,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeSearchRepository{}
+			uc := NewSearchUseCase(repo)
+			q := tt.q
+
+			summary, err := uc.GetSpendingSummary(context.Background(), &q)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetSpendingSummary() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.summaries) != 0 {
+					t.Errorf("invalid query reached Elasticsearch: %+v", repo.summaries)
+				}
+				return
+			}
+			if len(repo.summaries) != 1 || repo.summaries[0] != tt.want {
+				t.Errorf("queried %+v, want %+v", repo.summaries, tt.want)
+			}
+			// An account without transactions reports the default currency.
+			if summary.Currency != "IDR" {
+				t.Errorf("Currency = %q, want IDR", summary.Currency)
+			}
+		})
+	}
+}
@@ -1 +1,342 @@
 package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/apperr"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/money"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/repository"
+)
+
+// maxTopupAmount caps a single topup, in minor units, to limit the damage of a
+// mistyped amount.
+const maxTopupAmount = 1_000_000_000
+
+const maxIdempotencyKeyLength = 255
+
+// maxNotesLength caps a transaction's note, in characters.
+const maxNotesLength = 140
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+var (
+	ErrInvalidAccount     = apperr.New(apperr.ErrInvalidArgument, "ACCOUNT_ID_REQUIRED", "account id is required")
+	ErrInvalidAmount      = apperr.New(apperr.ErrInvalidArgument, "INVALID_AMOUNT", "amount must be greater than zero")
+	ErrAmountExceedsLimit = apperr.New(apperr.ErrInvalidArgument, "AMOUNT_EXCEEDS_LIMIT", fmt.Sprintf("amount must not exceed %d", maxTopupAmount))
+	ErrSelfTransfer       = apperr.New(apperr.ErrInvalidArgument, "SELF_TRANSFER", "cannot transfer to the same account")
+	ErrInvalidIdempotency = apperr.New(apperr.ErrInvalidArgument, "INVALID_IDEMPOTENCY_KEY", fmt.Sprintf("idempotency key must not exceed %d characters", maxIdempotencyKeyLength))
+	ErrNotesTooLong       = apperr.New(apperr.ErrInvalidArgument, "NOTES_TOO_LONG", fmt.Sprintf("notes must not exceed %d characters", maxNotesLength))
+	ErrInvalidPageToken   = apperr.New(apperr.ErrInvalidArgument, "INVALID_PAGE_TOKEN", "invalid page token")
+	ErrInvalidFilter      = apperr.New(apperr.ErrInvalidArgument, "INVALID_FILTER", "invalid history filter")
+	ErrEmailNotVerified   = apperr.New(apperr.ErrFailedPrecondition, "EMAIL_NOT_VERIFIED", "verify your email to transfer this amount")
+)
+
+var (
+	transactionsRecorded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "transactions_total",
+		Help: "Transactions recorded, by type and currency. Idempotent replays are not counted.",
+	}, []string{"type", "currency"})
+	transactionVolume = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "transaction_volume_minor_units_total",
+		Help: "Amount moved by recorded transactions in minor units, by type and currency.",
+	}, []string{"type", "currency"})
+)
+
+type TransactionUseCase interface {
+	Topup(ctx context.Context, accountID string, amount money.Money, notes, idempotencyKey string) (*model.Transaction, error)
+	Transfer(ctx context.Context, fromAccountID, toAccountID string, amount money.Money, notes, idempotencyKey string) (*model.Transaction, error)
+	PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+	ProvisionAccount(ctx context.Context, acc *model.Account) error
+	UpdateAccount(ctx context.Context, acc *model.Account) error
+	CloseWallet(ctx context.Context, accountID string) error
+	GetHistory(ctx context.Context, filter model.HistoryFilter, pageToken string, limit int) (*model.HistoryPage, error)
+}
+
+type transactionUseCase struct {
+	repo           repository.TransactionRepository
+	idempotencyTTL time.Duration
+	// unverifiedTransferLimit is the largest transfer, in minor units, an
+	// account with an unverified email may make.
+	unverifiedTransferLimit int64
+}
+
+func NewTransactionUseCase(repo repository.TransactionRepository, idempotencyTTL time.Duration, unverifiedTransferLimit int64) TransactionUseCase {
+	return &transactionUseCase{
+		repo:                    repo,
+		idempotencyTTL:          idempotencyTTL,
+		unverifiedTransferLimit: unverifiedTransferLimit,
+	}
+}
+
+// Topup credits amount to the account. notes is an optional note for the
+// history; without one the transaction is noted as "Topup".
+func (t *transactionUseCase) Topup(ctx context.Context, accountID string, amount money.Money, notes, idempotencyKey string) (*model.Transaction, error) {
+	if accountID == "" {
+		return nil, ErrInvalidAccount
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return nil, ErrInvalidIdempotency
+	}
+	notes = strings.TrimSpace(notes)
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		return nil, ErrNotesTooLong
+	}
+	if err := validateAmount(amount); err != nil {
+		return nil, err
+	}
+	if amount.Amount > maxTopupAmount {
+		return nil, ErrAmountExceedsLimit
+	}
+
+	newUUID, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate UUID: %w", err)
+	}
+
+	tx := &model.Transaction{
+		ID:              newUUID.String(),
+		ToAccountID:     accountID,
+		Amount:          amount.Amount,
+		Currency:        amount.Currency,
+		TransactionType: model.Topup,
+		Notes:           notesOrDefault(notes, "Topup"),
+		CreatedAt:       time.Now(),
+	}
+	recorded, err := t.repo.Topup(ctx, tx, t.newIdempotencyKey(idempotencyKey, accountID, notes, tx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to topup account: %w", err)
+	}
+	countTransaction(tx, recorded)
+
+	return recorded, nil
+}
+
+// Transfer moves amount between two accounts. notes is an optional note for
+// both parties' history; without one the transaction is noted as "Transfer".
+func (t *transactionUseCase) Transfer(ctx context.Context, fromAccountID, toAccountID string, amount money.Money, notes, idempotencyKey string) (*model.Transaction, error) {
+	if fromAccountID == "" || toAccountID == "" {
+		return nil, ErrInvalidAccount
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return nil, ErrInvalidIdempotency
+	}
+	notes = strings.TrimSpace(notes)
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		return nil, ErrNotesTooLong
+	}
+	if fromAccountID == toAccountID {
+		return nil, ErrSelfTransfer
+	}
+	if err := validateAmount(amount); err != nil {
+		return nil, err
+	}
+	if amount.Amount > t.unverifiedTransferLimit {
+		verified, err := t.repo.IsEmailVerified(ctx, fromAccountID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check email verification: %w", err)
+		}
+		if !verified {
+			return nil, ErrEmailNotVerified
+		}
+	}
+
+	newUUID, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate UUID: %w", err)
+	}
+
+	tx := &model.Transaction{
+		ID:              newUUID.String(),
+		FromAccountID:   fromAccountID,
+		ToAccountID:     toAccountID,
+		Amount:          amount.Amount,
+		Currency:        amount.Currency,
+		TransactionType: model.Transfer,
+		Notes:           notesOrDefault(notes, "Transfer"),
+		CreatedAt:       time.Now(),
+	}
+	recorded, err := t.repo.Transfer(ctx, tx, t.newIdempotencyKey(idempotencyKey, fromAccountID, notes, tx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer funds: %w", err)
+	}
+	countTransaction(tx, recorded)
+
+	return recorded, nil
+}
+
+// countTransaction adds tx to the business counters unless the repository
+// returned an earlier transaction for a replayed idempotency key instead.
+func countTransaction(tx, recorded *model.Transaction) {
+	if recorded.ID != tx.ID {
+		return
+	}
+	labels := []string{string(tx.TransactionType), tx.Currency}
+	transactionsRecorded.WithLabelValues(labels...).Inc()
+	transactionVolume.WithLabelValues(labels...).Add(float64(tx.Amount))
+}
+
+func (t *transactionUseCase) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	purged, err := t.repo.PurgeExpiredIdempotencyKeys(ctx, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge expired idempotency keys: %w", err)
+	}
+	return purged, nil
+}
+
+// newIdempotencyKey scopes key to the account that initiated tx and fingerprints
+// the request, so a key reused with a different payload can be rejected. The
+// client's notes count only when it sent some, so requests without notes keep
+// the fingerprint they had before notes existed. It returns nil when the
+// client did not send a key.
+func (t *transactionUseCase) newIdempotencyKey(key, accountID, notes string, tx *model.Transaction) *model.IdempotencyKey {
+	if key == "" {
+		return nil
+	}
+
+	request := fmt.Sprintf("%s|%s|%s|%d|%s", tx.TransactionType, tx.FromAccountID, tx.ToAccountID, tx.Amount, tx.Currency)
+	if notes != "" {
+		request += "|" + notes
+	}
+	fingerprint := sha256.Sum256([]byte(request))
+	return &model.IdempotencyKey{
+		Key:           key,
+		AccountID:     accountID,
+		RequestHash:   hex.EncodeToString(fingerprint[:]),
+		TransactionID: tx.ID,
+		CreatedAt:     tx.CreatedAt,
+		ExpiresAt:     tx.CreatedAt.Add(t.idempotencyTTL),
+	}
+}
+
+func notesOrDefault(notes, fallback string) string {
+	if notes == "" {
+		return fallback
+	}
+	return notes
+}
+
+func validateAmount(amount money.Money) error {
+	if amount.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if _, err := money.Exponent(amount.Currency); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ProvisionAccount creates the local wallet for an account registered in
+// account-service. It is safe to call more than once for the same account.
+func (t *transactionUseCase) ProvisionAccount(ctx context.Context, acc *model.Account) error {
+	if acc.ID == "" {
+		return ErrInvalidAccount
+	}
+	if err := t.repo.CreateAccount(ctx, acc); err != nil {
+		return fmt.Errorf("failed to provision account: %w", err)
+	}
+	return nil
+}
+
+// UpdateAccount applies a name or email change made in account-service. Changes
+// older than the last one applied are ignored, so events may arrive out of order.
+func (t *transactionUseCase) UpdateAccount(ctx context.Context, acc *model.Account) error {
+	if acc.ID == "" {
+		return ErrInvalidAccount
+	}
+	if err := t.repo.UpdateAccount(ctx, acc); err != nil {
+		return fmt.Errorf("failed to update account: %w", err)
+	}
+	return nil
+}
+
+// CloseWallet closes the account's wallet if its balance is zero. It is safe to
+// call more than once for the same account.
+func (t *transactionUseCase) CloseWallet(ctx context.Context, accountID string) error {
+	if accountID == "" {
+		return ErrInvalidAccount
+	}
+	if err := t.repo.CloseAccount(ctx, accountID); err != nil {
+		return fmt.Errorf("failed to close wallet: %w", err)
+	}
+	return nil
+}
+
+// GetHistory returns one page of the account's transactions matching filter,
+// newest first, starting after the position encoded in pageToken.
+func (t *transactionUseCase) GetHistory(ctx context.Context, filter model.HistoryFilter, pageToken string, limit int) (*model.HistoryPage, error) {
+	if filter.AccountID == "" {
+		return nil, ErrInvalidAccount
+	}
+	if err := validateHistoryFilter(filter); err != nil {
+		return nil, err
+	}
+	if limit < 1 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	var after *model.HistoryCursor
+	if pageToken != "" {
+		cursor, err := decodePageToken(filter, pageToken)
+		if err != nil {
+			return nil, err
+		}
+		after = cursor
+	}
+
+	// One extra row tells whether another page follows.
+	transactions, err := t.repo.FindHistory(ctx, filter, after, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction history: %w", err)
+	}
+
+	page := &model.HistoryPage{Limit: limit}
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[limit-1]
+		page.NextPageToken, err = encodePageToken(filter, &model.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		if err != nil {
+			return nil, err
+		}
+	}
+	page.Transactions = transactions
+	return page, nil
+}
+
+func validateHistoryFilter(filter model.HistoryFilter) error {
+	switch filter.TransactionType {
+	case "", model.Topup, model.Transfer:
+	default:
+		return ErrInvalidFilter.Withf("unknown transaction type %q", filter.TransactionType)
+	}
+	switch filter.Direction {
+	case "", model.Incoming, model.Outgoing:
+	default:
+		return ErrInvalidFilter.Withf("unknown direction %q", filter.Direction)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return ErrInvalidFilter.Withf("from_time must be before to_time")
+	}
+	if filter.MinAmount < 0 || filter.MaxAmount < 0 {
+		return ErrInvalidFilter.Withf("amounts must not be negative")
+	}
+	if filter.MaxAmount > 0 && filter.MinAmount > filter.MaxAmount {
+		return ErrInvalidFilter.Withf("min_amount must not exceed max_amount")
+	}
+	return nil
+}
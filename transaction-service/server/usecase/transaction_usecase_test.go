@@ -0,0 +1,229 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/model"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/money"
+	"github.com/zuyatna/emoney-microservice/transaction-service/server/repository"
+)
+
+// fakeTransactionRepository records the topups and transfers it is asked to
+// write. Methods the tests do not use panic through the embedded nil interface.
+type fakeTransactionRepository struct {
+	repository.TransactionRepository
+	topups    []*model.Transaction
+	transfers []*model.Transaction
+	keys      []*model.IdempotencyKey
+}
+
+func (f *fakeTransactionRepository) Topup(_ context.Context, tx *model.Transaction, key *model.IdempotencyKey) (*model.Transaction, error) {
+	f.topups = append(f.topups, tx)
+	f.keys = append(f.keys, key)
+	return tx, nil
+}
+
+func (f *fakeTransactionRepository) Transfer(_ context.Context, tx *model.Transaction, key *model.IdempotencyKey) (*model.Transaction, error) {
+	f.transfers = append(f.transfers, tx)
+	f.keys = append(f.keys, key)
+	return tx, nil
+}
+
+func TestNewIdempotencyKey(t *testing.T) {
+	uc := &transactionUseCase{idempotencyTTL: 24 * time.Hour}
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := &model.Transaction{ID: "tx-1", FromAccountID: "acc-a", ToAccountID: "acc-b", Amount: 2500,
+		Currency: "IDR", TransactionType: model.Transfer, CreatedAt: createdAt}
+	firstKey := uc.newIdempotencyKey("key-1", "acc-a", "", first)
+
+	tests := []struct {
+		name     string
+		change   func(tx *model.Transaction)
+		wantSame bool
+	}{
+		{name: "retry", change: func(tx *model.Transaction) {
+			tx.ID = "tx-2"
+			tx.CreatedAt = createdAt.Add(time.Minute)
+			tx.Notes = "Retried"
+		}, wantSame: true},
+		{name: "other amount", change: func(tx *model.Transaction) { tx.Amount = 2501 }},
+		{name: "other currency", change: func(tx *model.Transaction) { tx.Currency = "USD" }},
+		{name: "other recipient", change: func(tx *model.Transaction) { tx.ToAccountID = "acc-c" }},
+		{name: "other type", change: func(tx *model.Transaction) {
+			tx.TransactionType = model.Topup
+			tx.FromAccountID = ""
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := *first
+			tt.change(&tx)
+			key := uc.newIdempotencyKey("key-1", "acc-a", "", &tx)
+
+			if same := key.RequestHash == firstKey.RequestHash; same != tt.wantSame {
+				t.Errorf("request hash matches the first request: %v, want %v", same, tt.wantSame)
+			}
+			if key.TransactionID != tx.ID {
+				t.Errorf("TransactionID = %q, want %q", key.TransactionID, tx.ID)
+			}
+			if want := tx.CreatedAt.Add(24 * time.Hour); !key.ExpiresAt.Equal(want) {
+				t.Errorf("ExpiresAt = %v, want %v", key.ExpiresAt, want)
+			}
+		})
+	}
+
+	if key := uc.newIdempotencyKey("", "acc-a", "", first); key != nil {
+		t.Errorf("newIdempotencyKey without a key = %+v, want nil", key)
+	}
+}
+
+func TestTopupValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		accountID string
+		amount    money.Money
+		wantErr   error
+	}{
+		{name: "valid", accountID: "acc-a", amount: money.Money{Amount: 10000, Currency: "IDR"}},
+		{name: "at the limit", accountID: "acc-a", amount: money.Money{Amount: maxTopupAmount, Currency: "IDR"}},
+		{name: "over the limit", accountID: "acc-a", amount: money.Money{Amount: maxTopupAmount + 1, Currency: "IDR"}, wantErr: ErrAmountExceedsLimit},
+		{name: "zero", accountID: "acc-a", amount: money.Money{Currency: "IDR"}, wantErr: ErrInvalidAmount},
+		{name: "negative", accountID: "acc-a", amount: money.Money{Amount: -100, Currency: "IDR"}, wantErr: ErrInvalidAmount},
+		{name: "no account", amount: money.Money{Amount: 10000, Currency: "IDR"}, wantErr: ErrInvalidAccount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeTransactionRepository{}
+			uc := &transactionUseCase{repo: repo, idempotencyTTL: time.Hour}
+
+			_, err := uc.Topup(context.Background(), tt.accountID, tt.amount, "", "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Topup() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.topups) != 0 {
+					t.Errorf("rejected topup was written")
+				}
+				return
+			}
+			if len(repo.topups) != 1 {
+				t.Fatalf("wrote %d topups, want 1", len(repo.topups))
+			}
+			tx := repo.topups[0]
+			if tx.TransactionType != model.Topup || tx.FromAccountID != "" || tx.ToAccountID != tt.accountID || tx.Amount != tt.amount.Amount || tx.ID == "" {
+				t.Errorf("wrote %+v", tx)
+			}
+		})
+	}
+}
+
+func TestTopupNotes(t *testing.T) {
+	tests := []struct {
+		name      string
+		notes     string
+		wantNotes string
+		wantErr   error
+	}{
+		{name: "default", wantNotes: "Topup"},
+		{name: "blank", notes: "   ", wantNotes: "Topup"},
+		{name: "given", notes: " salary ", wantNotes: "salary"},
+		{name: "at the limit", notes: strings.Repeat("é", maxNotesLength), wantNotes: strings.Repeat("é", maxNotesLength)},
+		{name: "too long", notes: strings.Repeat("a", maxNotesLength+1), wantErr: ErrNotesTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeTransactionRepository{}
+			uc := &transactionUseCase{repo: repo, idempotencyTTL: time.Hour}
+
+			_, err := uc.Topup(context.Background(), "acc-a", money.Money{Amount: 10000, Currency: "IDR"}, tt.notes, "key-1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Topup() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.topups) != 0 {
+					t.Errorf("rejected topup was written")
+				}
+				return
+			}
+			if len(repo.topups) != 1 || repo.topups[0].Notes != tt.wantNotes {
+				t.Fatalf("wrote %+v, want one topup noted %q", repo.topups, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func TestTopupNotesFingerprint(t *testing.T) {
+	repo := &fakeTransactionRepository{}
+	uc := &transactionUseCase{repo: repo, idempotencyTTL: time.Hour}
+	amount := money.Money{Amount: 10000, Currency: "IDR"}
+
+	for _, notes := range []string{"", "Topup", "salary", " salary"} {
+		if _, err := uc.Topup(context.Background(), "acc-a", amount, notes, "key-1"); err != nil {
+			t.Fatalf("Topup(%q) error = %v", notes, err)
+		}
+	}
+
+	hashes := make([]string, len(repo.keys))
+	for i, key := range repo.keys {
+		hashes[i] = key.RequestHash
+	}
+	// A key reused with other notes is a different request, but the default
+	// note a client left out is not something it sent.
+	if hashes[0] == hashes[1] || hashes[0] == hashes[2] || hashes[1] == hashes[2] {
+		t.Errorf("different notes share a fingerprint: %v", hashes)
+	}
+	if hashes[2] != hashes[3] {
+		t.Errorf("notes differing only in surrounding spaces have different fingerprints")
+	}
+}
+
+func TestTransferValidation(t *testing.T) {
+	idr := func(amount int64) money.Money { return money.Money{Amount: amount, Currency: "IDR"} }
+
+	tests := []struct {
+		name     string
+		from, to string
+		amount   money.Money
+		wantErr  error
+	}{
+		{name: "valid", from: "acc-a", to: "acc-b", amount: idr(2500)},
+		{name: "to self", from: "acc-a", to: "acc-a", amount: idr(2500), wantErr: ErrSelfTransfer},
+		{name: "no sender", to: "acc-b", amount: idr(2500), wantErr: ErrInvalidAccount},
+		{name: "no recipient", from: "acc-a", amount: idr(2500), wantErr: ErrInvalidAccount},
+		{name: "zero amount", from: "acc-a", to: "acc-b", amount: idr(0), wantErr: ErrInvalidAmount},
+		{name: "negative amount", from: "acc-a", to: "acc-b", amount: idr(-1), wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeTransactionRepository{}
+			uc := &transactionUseCase{repo: repo, idempotencyTTL: time.Hour, unverifiedTransferLimit: 1_000_000}
+
+			_, err := uc.Transfer(context.Background(), tt.from, tt.to, tt.amount, "", "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transfer() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.transfers) != 0 {
+					t.Errorf("rejected transfer was written")
+				}
+				return
+			}
+
+			if len(repo.transfers) != 1 {
+				t.Fatalf("wrote %d transfers, want 1", len(repo.transfers))
+			}
+			tx := repo.transfers[0]
+			if tx.TransactionType != model.Transfer || tx.FromAccountID != tt.from || tx.ToAccountID != tt.to || tx.Amount != tt.amount.Amount {
+				t.Errorf("wrote %+v", tx)
+			}
+		})
+	}
+}